@@ -18,9 +18,6 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-
-	"github.com/gookit/color"
 	"github.com/nirdosh17/cfn-teardown/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -42,13 +39,12 @@ Supply stack pattern as: 'qa-'
 		return validateConfigs(config)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		color.Red.Println("Executing command: deleteStacks")
-		fmt.Println()
+		utils.Logger.Info("Executing command: deleteStacks")
 		if config.DryRun != "false" {
-			fmt.Println("Running in dry run mode. Set dry run to 'false' to actually delete stacks.")
+			utils.Logger.Warn("Running in dry run mode. Set dry run to 'false' to actually delete stacks.")
 		}
 
-		utils.InitiateTearDown(config)
+		initiateTearDown(config)
 	},
 }
 
@@ -70,9 +66,108 @@ func init() {
 	deleteStacksCmd.Flags().String("SLACK_WEBHOOK_URL", "", "Send status alerts to Slack channel")
 	viper.BindPFlag("SLACK_WEBHOOK_URL", deleteStacksCmd.Flags().Lookup("SLACK_WEBHOOK_URL"))
 
+	deleteStacksCmd.Flags().String("SLACK_BOT_TOKEN", "", "Send status alerts to Slack channel as a single threaded message per run using bot token")
+	viper.BindPFlag("SLACK_BOT_TOKEN", deleteStacksCmd.Flags().Lookup("SLACK_BOT_TOKEN"))
+
+	deleteStacksCmd.Flags().String("SLACK_CHANNEL", "", "Slack channel to post alerts when using bot token")
+	viper.BindPFlag("SLACK_CHANNEL", deleteStacksCmd.Flags().Lookup("SLACK_CHANNEL"))
+
+	deleteStacksCmd.Flags().String("TEAMS_WEBHOOK_URL", "", "Send status alerts to Microsoft Teams channel")
+	viper.BindPFlag("TEAMS_WEBHOOK_URL", deleteStacksCmd.Flags().Lookup("TEAMS_WEBHOOK_URL"))
+
+	deleteStacksCmd.Flags().String("WEBHOOK_URL", "", "Post status alerts as json to a generic webhook")
+	viper.BindPFlag("WEBHOOK_URL", deleteStacksCmd.Flags().Lookup("WEBHOOK_URL"))
+
+	deleteStacksCmd.Flags().String("SNS_TOPIC_ARN", "", "Publish teardown lifecycle events as json to this SNS topic")
+	viper.BindPFlag("SNS_TOPIC_ARN", deleteStacksCmd.Flags().Lookup("SNS_TOPIC_ARN"))
+
+	deleteStacksCmd.Flags().String("EVENT_BUS_NAME", "", "Put teardown lifecycle events to this EventBridge bus e.g. 'default'")
+	viper.BindPFlag("EVENT_BUS_NAME", deleteStacksCmd.Flags().Lookup("EVENT_BUS_NAME"))
+
+	deleteStacksCmd.Flags().String("SMTP_HOST", "", "Send status alerts as email via this SMTP server")
+	viper.BindPFlag("SMTP_HOST", deleteStacksCmd.Flags().Lookup("SMTP_HOST"))
+
+	deleteStacksCmd.Flags().Int("SMTP_PORT", 587, "SMTP server port. STARTTLS is used if the server supports it")
+	viper.BindPFlag("SMTP_PORT", deleteStacksCmd.Flags().Lookup("SMTP_PORT"))
+
+	deleteStacksCmd.Flags().String("SMTP_USERNAME", "", "SMTP username. Authentication is skipped if empty")
+	viper.BindPFlag("SMTP_USERNAME", deleteStacksCmd.Flags().Lookup("SMTP_USERNAME"))
+
+	deleteStacksCmd.Flags().String("SMTP_PASSWORD", "", "SMTP password")
+	viper.BindPFlag("SMTP_PASSWORD", deleteStacksCmd.Flags().Lookup("SMTP_PASSWORD"))
+
+	deleteStacksCmd.Flags().String("EMAIL_FROM", "", "Sender address of alert emails")
+	viper.BindPFlag("EMAIL_FROM", deleteStacksCmd.Flags().Lookup("EMAIL_FROM"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO", "", "Comma separated recipients of alert emails for events without their own recipients")
+	viper.BindPFlag("EMAIL_TO", deleteStacksCmd.Flags().Lookup("EMAIL_TO"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_PLAN", "", "Comma separated recipients of Plan alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_PLAN", deleteStacksCmd.Flags().Lookup("EMAIL_TO_PLAN"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_START", "", "Comma separated recipients of Start alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_START", deleteStacksCmd.Flags().Lookup("EMAIL_TO_START"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_PROGRESS", "", "Comma separated recipients of Progress alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_PROGRESS", deleteStacksCmd.Flags().Lookup("EMAIL_TO_PROGRESS"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_ERROR", "", "Comma separated recipients of Error alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_ERROR", deleteStacksCmd.Flags().Lookup("EMAIL_TO_ERROR"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_STUCK", "", "Comma separated recipients of Stuck alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_STUCK", deleteStacksCmd.Flags().Lookup("EMAIL_TO_STUCK"))
+
+	deleteStacksCmd.Flags().String("EMAIL_TO_COMPLETE", "", "Comma separated recipients of Complete alert emails. Overrides EMAIL_TO, set to 'none' to skip")
+	viper.BindPFlag("EMAIL_TO_COMPLETE", deleteStacksCmd.Flags().Lookup("EMAIL_TO_COMPLETE"))
+
+	deleteStacksCmd.Flags().String("NOTIFICATION_TEMPLATES_DIR", "", "Directory with custom notification templates e.g. <dir>/slack/error.tmpl overrides built-in Slack error message")
+	viper.BindPFlag("NOTIFICATION_TEMPLATES_DIR", deleteStacksCmd.Flags().Lookup("NOTIFICATION_TEMPLATES_DIR"))
+
+	deleteStacksCmd.Flags().Int("NOTIFICATION_TIMEOUT_SECONDS", 10, "Timeout for a single notification request")
+	viper.BindPFlag("NOTIFICATION_TIMEOUT_SECONDS", deleteStacksCmd.Flags().Lookup("NOTIFICATION_TIMEOUT_SECONDS"))
+
+	deleteStacksCmd.Flags().Int("NOTIFICATION_MAX_ATTEMPTS", 5, "Max delivery attempts for a notification. Retried on network errors, 429 and 5xx responses")
+	viper.BindPFlag("NOTIFICATION_MAX_ATTEMPTS", deleteStacksCmd.Flags().Lookup("NOTIFICATION_MAX_ATTEMPTS"))
+
+	deleteStacksCmd.Flags().String("NOTIFICATION_DEAD_LETTER_FILE", "notification_dead_letters.jsonl", "File where notifications which could not be delivered are written")
+	viper.BindPFlag("NOTIFICATION_DEAD_LETTER_FILE", deleteStacksCmd.Flags().Lookup("NOTIFICATION_DEAD_LETTER_FILE"))
+
+	deleteStacksCmd.Flags().Int("PROGRESS_NOTIFY_EVERY_STACKS", 0, "Send progress alert after every N deleted stacks. Disabled if 0")
+	viper.BindPFlag("PROGRESS_NOTIFY_EVERY_STACKS", deleteStacksCmd.Flags().Lookup("PROGRESS_NOTIFY_EVERY_STACKS"))
+
+	deleteStacksCmd.Flags().Int("PROGRESS_NOTIFY_EVERY_MINUTES", 0, "Send progress alert every M minutes. Disabled if 0")
+	viper.BindPFlag("PROGRESS_NOTIFY_EVERY_MINUTES", deleteStacksCmd.Flags().Lookup("PROGRESS_NOTIFY_EVERY_MINUTES"))
+
+	deleteStacksCmd.Flags().Int("PROGRESS_NOTIFY_MIN_GAP_MINUTES", 5, "Minimum minutes between two progress alerts")
+	viper.BindPFlag("PROGRESS_NOTIFY_MIN_GAP_MINUTES", deleteStacksCmd.Flags().Lookup("PROGRESS_NOTIFY_MIN_GAP_MINUTES"))
+
+	deleteStacksCmd.Flags().String("REPORT_FORMATS", "", "Comma separated formats of the report written at the end of the run: markdown | json | junit. No report is written if empty")
+	viper.BindPFlag("REPORT_FORMATS", deleteStacksCmd.Flags().Lookup("REPORT_FORMATS"))
+
+	deleteStacksCmd.Flags().String("REPORT_DIR", ".", "Directory where reports are written")
+	viper.BindPFlag("REPORT_DIR", deleteStacksCmd.Flags().Lookup("REPORT_DIR"))
+
+	deleteStacksCmd.Flags().String("METRICS_ADDRESS", "", "Address to serve prometheus metrics on '/metrics' during the teardown e.g. ':9090'. Disabled if empty")
+	viper.BindPFlag("METRICS_ADDRESS", deleteStacksCmd.Flags().Lookup("METRICS_ADDRESS"))
+
+	deleteStacksCmd.Flags().String("PUSHGATEWAY_URL", "", "Prometheus Pushgateway URL to push the final metrics at the end of the teardown e.g. 'http://pushgateway:9091'. Disabled if empty")
+	viper.BindPFlag("PUSHGATEWAY_URL", deleteStacksCmd.Flags().Lookup("PUSHGATEWAY_URL"))
+
+	deleteStacksCmd.Flags().String("PUSHGATEWAY_JOB", "cfn-teardown", "Job name used for the metrics pushed to the Pushgateway")
+	viper.BindPFlag("PUSHGATEWAY_JOB", deleteStacksCmd.Flags().Lookup("PUSHGATEWAY_JOB"))
+
+	deleteStacksCmd.Flags().String("OTLP_ENDPOINT", "", "OTLP/HTTP endpoint to export traces of the teardown e.g. 'http://localhost:4318'. Disabled if empty")
+	viper.BindPFlag("OTLP_ENDPOINT", deleteStacksCmd.Flags().Lookup("OTLP_ENDPOINT"))
+
+	deleteStacksCmd.Flags().Bool("NOTIFY_DRY_RUN", false, "Send the plan of a dry run i.e. stacks and order of deletion to the notification channels")
+	viper.BindPFlag("NOTIFY_DRY_RUN", deleteStacksCmd.Flags().Lookup("NOTIFY_DRY_RUN"))
+
 	deleteStacksCmd.Flags().String("DRY_RUN", "true", "[Safety Check] To delete stacks, it needs to be explicitly set to false")
 	viper.BindPFlag("DRY_RUN", deleteStacksCmd.Flags().Lookup("DRY_RUN"))
 
+	deleteStacksCmd.Flags().Bool("RETAIN_FAILED_RESOURCES", false, "[Opt-in] After exhausting delete attempts, delete the stack once more retaining resources which failed to delete")
+	viper.BindPFlag("RETAIN_FAILED_RESOURCES", deleteStacksCmd.Flags().Lookup("RETAIN_FAILED_RESOURCES"))
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -18,9 +18,6 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-
-	"github.com/gookit/color"
 	"github.com/nirdosh17/cfn-teardown/utils"
 	"github.com/spf13/cobra"
 )
@@ -42,14 +39,12 @@ Supply stack pattern as: 'qa-'
 		return validateConfigs(config)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println()
-		color.Green.Println("Executing command: listDependencies")
-		fmt.Println()
+		utils.Logger.Info("Executing command: listDependencies")
 		// for safety
 		config.DryRun = "true"
-		fmt.Println("Running in dry run mode...")
+		utils.Logger.Info("Running in dry run mode...")
 
-		utils.InitiateTearDown(config)
+		initiateTearDown(config)
 	},
 }
 
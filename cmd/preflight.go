@@ -0,0 +1,51 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd provides interface to register and define actions for all cli commands
+package cmd
+
+import (
+	"github.com/nirdosh17/cfn-teardown/utils"
+	"github.com/spf13/cobra"
+)
+
+// preflightCmd represents the preflight command
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check IAM permissions needed to delete matching stacks",
+	Long: `Scan stacks matching the given pattern and simulate IAM policies of the principal deleting them
+for every action the teardown needs, per resource type in the matched stacks.
+Missing permissions are reported and the command exits with a non-zero code. Nothing is deleted.
+	`,
+	Example: "cfn-teardown preflight --STACK_PATTERN='^qa-' --AWS_PROFILE=staging --AWS_REGION=us-east-1",
+
+	Args: func(cmd *cobra.Command, args []string) error {
+		// validate your arguments here
+		return validateConfigs(config)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Logger.Info("Executing command: preflight")
+		// for safety
+		config.DryRun = "true"
+		config.PreflightOnly = true
+
+		initiateTearDown(config)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+}
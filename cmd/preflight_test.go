@@ -0,0 +1,61 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+	"github.com/nirdosh17/cfn-teardown/utils"
+)
+
+func TestPreflightCommandAcceptsOptInFlags(t *testing.T) {
+	var got models.Config
+	initiateTearDown = func(c models.Config) { got = c }
+	t.Cleanup(func() { initiateTearDown = utils.InitiateTearDown })
+
+	cfgPath := filepath.Join(t.TempDir(), "cfn-teardown.yaml")
+	if err := os.WriteFile(cfgPath, []byte("LOG_LEVEL: error\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{
+		"preflight", "--config", cfgPath, "--STACK_PATTERN=^qa-", "--AWS_REGION=us-east-1",
+		"--DISABLE_TERMINATION_PROTECTION=true",
+		"--DELETE_STACKSET_INSTANCES=true",
+		"--DELETE_EMPTY_STACKSETS=true",
+		"--STACKSET_ADMIN_ROLE_ARN=arn:aws:iam::121212121212:role/stackset-admin",
+		"--STACKSET_REGION=eu-west-1",
+		"--STACKSET_CALL_AS=DELEGATED_ADMIN",
+		"--SKIP_PREFLIGHT=true",
+	})
+	t.Cleanup(func() { rootCmd.SetArgs(nil) })
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.PreflightOnly || got.DryRun != "true" {
+		t.Errorf("expected a dry preflight run, got PreflightOnly=%v DryRun=%v", got.PreflightOnly, got.DryRun)
+	}
+	if !got.DisableTerminationProtection || !got.DeleteStackSetInstances || !got.DeleteEmptyStackSets || !got.SkipPreflight {
+		t.Errorf("expected opt-in flags to be set, got %+v", got)
+	}
+	if got.StackSetAdminRoleARN != "arn:aws:iam::121212121212:role/stackset-admin" || got.StackSetRegion != "eu-west-1" || got.StackSetCallAs != "DELEGATED_ADMIN" {
+		t.Errorf("unexpected StackSet config %v, %v, %v", got.StackSetAdminRoleARN, got.StackSetRegion, got.StackSetCallAs)
+	}
+}
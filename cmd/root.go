@@ -30,12 +30,16 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/nirdosh17/cfn-teardown/models"
+	"github.com/nirdosh17/cfn-teardown/utils"
 )
 
 // config vars
 var (
 	cfgFile string
 	config  models.Config
+
+	// initiateTearDown runs the teardown with the parsed config, replaced in tests
+	initiateTearDown = utils.InitiateTearDown
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -78,14 +82,34 @@ func validateConfigs(config models.Config) (err error) {
 		emptyFlags = append(emptyFlags, "STACK_PATTERN")
 	}
 
-	if config.AWSProfile == "" {
-		emptyFlags = append(emptyFlags, "AWS_PROFILE")
+	// web identity token is exchanged for credentials of the web identity role
+	if config.WebIdentityTokenFile != "" && config.WebIdentityRoleARN == "" {
+		emptyFlags = append(emptyFlags, "WEB_IDENTITY_ROLE_ARN")
 	}
 
-	if config.AWSRegion == "" {
+	// regions can be listed per account in the accounts manifest
+	if config.AWSRegion == "" && config.AWSRegions == "" && config.AccountsManifest == "" {
 		emptyFlags = append(emptyFlags, "AWS_REGION")
 	}
 
+	if config.SlackBotToken != "" && config.SlackChannel == "" {
+		emptyFlags = append(emptyFlags, "SLACK_CHANNEL")
+	}
+
+	if config.SMTPHost != "" {
+		if config.EmailFrom == "" {
+			emptyFlags = append(emptyFlags, "EMAIL_FROM")
+		}
+		// EMAIL_TO is only used for events without recipients of their own, 'none' included
+		eventRecipients := []string{config.EmailToPlan, config.EmailToStart, config.EmailToProgress, config.EmailToError, config.EmailToStuck, config.EmailToComplete}
+		for _, recipients := range eventRecipients {
+			if config.EmailTo == "" && len(utils.ParseRecipients(recipients)) == 0 {
+				emptyFlags = append(emptyFlags, "EMAIL_TO")
+				break
+			}
+		}
+	}
+
 	if len(emptyFlags) > 0 {
 		err = errors.New("required flag(s) " + strings.Join(emptyFlags, ", ") + " not set")
 	}
@@ -105,12 +129,70 @@ func init() {
 	rootCmd.PersistentFlags().String("AWS_REGION", "", "AWS Region where the stacks are present")
 	viper.BindPFlag("AWS_REGION", rootCmd.PersistentFlags().Lookup("AWS_REGION"))
 
-	rootCmd.PersistentFlags().String("AWS_PROFILE", "", "AWS Profile")
+	rootCmd.PersistentFlags().String("AWS_REGIONS", "", "Comma separated AWS regions to delete stacks from in a single run e.g. 'eu-west-1,us-east-1'. Overrides AWS_REGION")
+	viper.BindPFlag("AWS_REGIONS", rootCmd.PersistentFlags().Lookup("AWS_REGIONS"))
+
+	rootCmd.PersistentFlags().String("REGION_ORDER", "", "Comma separated ordering constraints across AWS_REGIONS e.g. 'eu-west-1>us-east-1' deletes all stacks of eu-west-1 before any stack of us-east-1")
+	viper.BindPFlag("REGION_ORDER", rootCmd.PersistentFlags().Lookup("REGION_ORDER"))
+
+	rootCmd.PersistentFlags().String("AWS_PROFILE", "", "AWS Profile. Uses the default credential chain if empty i.e. environment variables, web identity token file, ECS or EC2 roles")
 	viper.BindPFlag("AWS_PROFILE", rootCmd.PersistentFlags().Lookup("AWS_PROFILE"))
 
 	rootCmd.PersistentFlags().String("ROLE_ARN", "", "Assume this role to scan and delete stacks if provided")
 	viper.BindPFlag("ROLE_ARN", rootCmd.PersistentFlags().Lookup("ROLE_ARN"))
 
+	rootCmd.PersistentFlags().String("ROLE_EXTERNAL_ID", "", "External id passed while assuming ROLE_ARN, roles of the accounts manifest and the StackSet administrator role")
+	viper.BindPFlag("ROLE_EXTERNAL_ID", rootCmd.PersistentFlags().Lookup("ROLE_EXTERNAL_ID"))
+
+	rootCmd.PersistentFlags().String("ROLE_SESSION_NAME", utils.DEFAULT_ROLE_SESSION_NAME, "Session name of the assumed roles, shown in CloudTrail")
+	viper.BindPFlag("ROLE_SESSION_NAME", rootCmd.PersistentFlags().Lookup("ROLE_SESSION_NAME"))
+
+	rootCmd.PersistentFlags().String("ROLE_MFA_SERIAL", "", "MFA device serial number or ARN required to assume the roles. Token code is prompted once per role")
+	viper.BindPFlag("ROLE_MFA_SERIAL", rootCmd.PersistentFlags().Lookup("ROLE_MFA_SERIAL"))
+
+	rootCmd.PersistentFlags().String("WEB_IDENTITY_ROLE_ARN", "", "Role assumed with the web identity token of WEB_IDENTITY_TOKEN_FILE e.g. OIDC token of a CI job. ROLE_ARN is assumed on top of it if provided")
+	viper.BindPFlag("WEB_IDENTITY_ROLE_ARN", rootCmd.PersistentFlags().Lookup("WEB_IDENTITY_ROLE_ARN"))
+
+	rootCmd.PersistentFlags().String("WEB_IDENTITY_TOKEN_FILE", "", "Path of the web identity token file used to assume WEB_IDENTITY_ROLE_ARN")
+	viper.BindPFlag("WEB_IDENTITY_TOKEN_FILE", rootCmd.PersistentFlags().Lookup("WEB_IDENTITY_TOKEN_FILE"))
+
+	rootCmd.PersistentFlags().String("ACCOUNTS_MANIFEST", "", "Path of yaml file listing accounts to delete stacks from in a single run along with the role to assume and regions of each account")
+	viper.BindPFlag("ACCOUNTS_MANIFEST", rootCmd.PersistentFlags().Lookup("ACCOUNTS_MANIFEST"))
+
+	rootCmd.PersistentFlags().String("STACK_DEPENDENCIES", "", "Comma separated dependencies which can't be found via imports e.g. 'eu-west-1/qa-cdn>us-east-1/qa-certs' deletes qa-cdn in eu-west-1 before qa-certs in us-east-1")
+	viper.BindPFlag("STACK_DEPENDENCIES", rootCmd.PersistentFlags().Lookup("STACK_DEPENDENCIES"))
+
+	rootCmd.PersistentFlags().Bool("SSM_DEPENDENCIES", false, "Find dependencies of stacks reading SSM parameters created by other stacks e.g. replicated to other regions")
+	viper.BindPFlag("SSM_DEPENDENCIES", rootCmd.PersistentFlags().Lookup("SSM_DEPENDENCIES"))
+
+	// used by the preflight command as well to check permissions of the opt-in actions
+	rootCmd.PersistentFlags().Bool("DISABLE_TERMINATION_PROTECTION", false, "[Opt-in] Disable termination protection of matching stacks right before deleting them")
+	viper.BindPFlag("DISABLE_TERMINATION_PROTECTION", rootCmd.PersistentFlags().Lookup("DISABLE_TERMINATION_PROTECTION"))
+
+	rootCmd.PersistentFlags().Bool("DELETE_STACKSET_INSTANCES", false, "[Opt-in] Delete matching stacks managed by StackSets by removing their stack instances from the StackSets in the administrator account")
+	viper.BindPFlag("DELETE_STACKSET_INSTANCES", rootCmd.PersistentFlags().Lookup("DELETE_STACKSET_INSTANCES"))
+
+	rootCmd.PersistentFlags().Bool("DELETE_EMPTY_STACKSETS", false, "[Opt-in] Delete a StackSet once its last stack instance has been removed. Requires DELETE_STACKSET_INSTANCES")
+	viper.BindPFlag("DELETE_EMPTY_STACKSETS", rootCmd.PersistentFlags().Lookup("DELETE_EMPTY_STACKSETS"))
+
+	rootCmd.PersistentFlags().String("STACKSET_ADMIN_ROLE_ARN", "", "Role of the StackSet administrator account assumed to remove stack instances. Uses the AWS credentials as is if empty")
+	viper.BindPFlag("STACKSET_ADMIN_ROLE_ARN", rootCmd.PersistentFlags().Lookup("STACKSET_ADMIN_ROLE_ARN"))
+
+	rootCmd.PersistentFlags().String("STACKSET_REGION", "", "Region of the StackSets in the administrator account. Defaults to AWS_REGION")
+	viper.BindPFlag("STACKSET_REGION", rootCmd.PersistentFlags().Lookup("STACKSET_REGION"))
+
+	rootCmd.PersistentFlags().String("STACKSET_CALL_AS", "SELF", "Whether StackSets are administered by the account itself or by a delegated administrator of the organization: SELF | DELEGATED_ADMIN")
+	viper.BindPFlag("STACKSET_CALL_AS", rootCmd.PersistentFlags().Lookup("STACKSET_CALL_AS"))
+
+	rootCmd.PersistentFlags().Bool("SKIP_PREFLIGHT", false, "[Opt-out] Skip simulating IAM permissions needed for the teardown before deleting anything")
+	viper.BindPFlag("SKIP_PREFLIGHT", rootCmd.PersistentFlags().Lookup("SKIP_PREFLIGHT"))
+
+	rootCmd.PersistentFlags().String("LOG_FORMAT", "text", "Log format: text | json")
+	viper.BindPFlag("LOG_FORMAT", rootCmd.PersistentFlags().Lookup("LOG_FORMAT"))
+
+	rootCmd.PersistentFlags().String("LOG_LEVEL", "info", "Log level: debug | info | warn | error")
+	viper.BindPFlag("LOG_LEVEL", rootCmd.PersistentFlags().Lookup("LOG_LEVEL"))
+
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cfn-teardown.yaml)")
 
 	// Cobra also supports local flags, which will only run
@@ -141,11 +223,14 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file: ", viper.ConfigFileUsed())
 		err = viper.Unmarshal(&config)
 		if err != nil {
 			log.Fatalf("Error parsing config, %s", err)
 		}
+		if err = utils.InitLogger(config.LogFormat, config.LogLevel); err != nil {
+			log.Fatalf("Error parsing config, %s", err)
+		}
+		utils.Logger.Info("Using config file", "file", viper.ConfigFileUsed())
 	} else {
 		log.Fatalf("Error reading config file, %s", err)
 	}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func TestValidateConfigsRequiresEmailToForEventsWithoutRecipients(t *testing.T) {
+	emailConfig := func(update func(c *models.Config)) models.Config {
+		c := models.Config{StackPattern: "^qa-", AWSRegion: "us-east-1", SMTPHost: "smtp.example.com", EmailFrom: "teardown@example.com"}
+		update(&c)
+		return c
+	}
+	allEvents := func(c *models.Config) {
+		c.EmailToPlan = "qa@example.com"
+		c.EmailToStart = "qa@example.com"
+		c.EmailToProgress = "none"
+		c.EmailToError = "oncall@example.com, qa@example.com"
+		c.EmailToStuck = "oncall@example.com"
+		c.EmailToComplete = "none"
+	}
+
+	tests := []struct {
+		name    string
+		config  models.Config
+		wantErr bool
+	}{
+		{"email to is set", emailConfig(func(c *models.Config) { c.EmailTo = "qa@example.com" }), false},
+		{"every event has recipients or is skipped", emailConfig(allEvents), false},
+		{"no recipients at all", emailConfig(func(c *models.Config) {}), true},
+		{"an event without recipients", emailConfig(func(c *models.Config) { allEvents(c); c.EmailToStuck = "" }), true},
+		{"an event with blank recipients", emailConfig(func(c *models.Config) { allEvents(c); c.EmailToComplete = " , " }), true},
+		{"emails are not sent", models.Config{StackPattern: "^qa-", AWSRegion: "us-east-1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfigs(tt.config)
+			if tt.wantErr && (err == nil || err.Error() != "required flag(s) EMAIL_TO not set") {
+				t.Errorf("expected EMAIL_TO to be required, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
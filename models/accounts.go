@@ -0,0 +1,29 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// AccountsManifest lists the accounts whose stacks are deleted in a single run.
+type AccountsManifest struct {
+	Accounts []AccountManifest `yaml:"accounts"`
+}
+
+// AccountManifest is an account along with the role assumed to delete its stacks.
+type AccountManifest struct {
+	AccountID string   `yaml:"account_id"`
+	RoleARN   string   `yaml:"role_arn"` // stacks are deleted with the aws profile if empty
+	Regions   []string `yaml:"regions"`  // defaults to AWS_REGIONS or AWS_REGION
+}
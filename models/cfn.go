@@ -19,18 +19,58 @@ package models
 
 // StackDetails represents a cloudformation stack, it's state and dependencies.
 type StackDetails struct {
-	StackName             string
-	Status                string
-	StackStatusReason     string // useful for failed cases
-	DeleteStartedAt       string
-	DeleteCompletedAt     string
-	DeletionTimeInMinutes string
-	DeleteAttempt         int16
-	Exports               []string
-	ActiveImporterStacks  map[string]struct{} // active(not deleted) stacks which are importing exports from this stack
-	CFNConsoleLink        string
+	StackName                       string
+	Region                          string
+	AccountID                       string // only set for accounts listed in the accounts manifest
+	Status                          string
+	StackStatusReason               string // useful for failed cases
+	DeleteStartedAt                 string // time of the latest delete request, reset on every retry
+	FirstDeleteStartedAt            string // time of the first delete request, kept across retries
+	DeleteCompletedAt               string
+	DeletionTimeInMinutes           string // from the first delete request, including retries
+	DeleteAttempt                   int16
+	Exports                         []string
+	ActiveImporterStacks            map[string]struct{} // active(not deleted) stacks which are importing exports from this stack
+	ExternalImporterStacks          map[string]string   // stacks depending on this stack which can't be found via imports e.g. in other regions. Stack key -> source of the dependency: 'declared' or 'ssm:<parameter name>'
+	CFNConsoleLink                  string
+	TerminationProtection           bool // stack can't be deleted unless termination protection is disabled first
+	TerminationProtectionDisabledAt string
+	ECRImagesDeleted                int              // images purged from ECR repositories owned by this stack before deletion
+	Route53RecordsDeleted           []string         // records removed from hosted zones owned by this stack before deletion in 'NAME TYPE' format
+	FailedResources                 []FailedResource // root cause of deletion failure per resource taken from stack events
+	RetainedResources               []FailedResource // resources skipped while deleting the stack after it failed to delete, they need to be cleaned up manually
+	StackSetName                    string           // set for stacks managed by a StackSet, they are deleted by removing their stack instance from the StackSet
+	StackSetOperationId             string           // latest StackSet operation removing the stack instance
+	StackSetDeletedAt               string           // set if the StackSet was deleted after its last stack instance was removed
+	ServiceRoleARN                  string           // role used by CloudFormation to delete resources of the stack instead of the caller's permissions
 }
 
+// FailedResource represents a stack resource which could not be deleted.
+type FailedResource struct {
+	LogicalResourceId  string
+	PhysicalResourceId string
+	ResourceType       string
+	StatusReason       string
+	Cause              string // one of the failure causes below derived from the status reason
+}
+
+// ---------- Common causes of resource deletion failure ------------
+
+// DEPENDENCY_VIOLATION failure cause means the resource is referenced by another resource e.g. security group attached to a network interface.
+var DEPENDENCY_VIOLATION string = "DEPENDENCY_VIOLATION"
+
+// ACCESS_DENIED failure cause means the caller is not allowed to delete the resource.
+var ACCESS_DENIED string = "ACCESS_DENIED"
+
+// RESOURCE_IN_USE failure cause means the resource is being used and can't be deleted at the moment.
+var RESOURCE_IN_USE string = "RESOURCE_IN_USE"
+
+// RESOURCE_NOT_EMPTY failure cause means the resource has contents which need to be deleted first e.g. objects in a bucket.
+var RESOURCE_NOT_EMPTY string = "RESOURCE_NOT_EMPTY"
+
+// UNKNOWN failure cause is used when the status reason does not match any known cause.
+var UNKNOWN string = "UNKNOWN"
+
 // ---------- Stack statuses and their eligibility for deletion ------------
 // https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/using-cfn-describing-stacks.html
 
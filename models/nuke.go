@@ -19,15 +19,69 @@ package models
 
 // Config represents all the parameters supported by cfn-teardown
 type Config struct {
-	AWSProfile           string  `mapstructure:"AWS_PROFILE"`
-	AWSRegion            string  `mapstructure:"AWS_REGION"`
-	TargetAccountId      string  `mapstructure:"TARGET_ACCOUNT_ID"`
-	StackPattern         string  `mapstructure:"STACK_PATTERN"`
-	StackWaitTimeSeconds int16   `mapstructure:"STACK_WAIT_TIME_SECONDS"`
-	MaxDeleteRetryCount  int16   `mapstructure:"MAX_DELETE_RETRY_COUNT"`
-	AbortWaitTimeMinutes int16   `mapstructure:"ABORT_WAIT_TIME_MINUTES"`
-	SlackWebhookURL      string  `mapstructure:"SLACK_WEBHOOK_URL"`
-	RoleARN              string  `mapstructure:"ROLE_ARN"`
-	DryRun               string  `mapstructure:"DRY_RUN"`
-	EndpointURL          *string `mapstructure:"ENDPOINT_URL"`
+	AWSProfile                  string  `mapstructure:"AWS_PROFILE"`
+	AWSRegion                   string  `mapstructure:"AWS_REGION"`
+	AWSRegions                  string  `mapstructure:"AWS_REGIONS"`
+	RegionOrder                 string  `mapstructure:"REGION_ORDER"`
+	AccountsManifest            string  `mapstructure:"ACCOUNTS_MANIFEST"`
+	StackDependencies           string  `mapstructure:"STACK_DEPENDENCIES"`
+	TargetAccountId             string  `mapstructure:"TARGET_ACCOUNT_ID"`
+	StackPattern                string  `mapstructure:"STACK_PATTERN"`
+	StackWaitTimeSeconds        int16   `mapstructure:"STACK_WAIT_TIME_SECONDS"`
+	MaxDeleteRetryCount         int16   `mapstructure:"MAX_DELETE_RETRY_COUNT"`
+	AbortWaitTimeMinutes        int16   `mapstructure:"ABORT_WAIT_TIME_MINUTES"`
+	SlackWebhookURL             string  `mapstructure:"SLACK_WEBHOOK_URL"`
+	SlackBotToken               string  `mapstructure:"SLACK_BOT_TOKEN"`
+	SlackChannel                string  `mapstructure:"SLACK_CHANNEL"`
+	TeamsWebhookURL             string  `mapstructure:"TEAMS_WEBHOOK_URL"`
+	WebhookURL                  string  `mapstructure:"WEBHOOK_URL"`
+	SNSTopicARN                 string  `mapstructure:"SNS_TOPIC_ARN"`
+	EventBusName                string  `mapstructure:"EVENT_BUS_NAME"`
+	SMTPHost                    string  `mapstructure:"SMTP_HOST"`
+	SMTPPort                    int     `mapstructure:"SMTP_PORT"`
+	SMTPUsername                string  `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword                string  `mapstructure:"SMTP_PASSWORD"`
+	EmailFrom                   string  `mapstructure:"EMAIL_FROM"`
+	EmailTo                     string  `mapstructure:"EMAIL_TO"`
+	EmailToPlan                 string  `mapstructure:"EMAIL_TO_PLAN"`
+	EmailToStart                string  `mapstructure:"EMAIL_TO_START"`
+	EmailToProgress             string  `mapstructure:"EMAIL_TO_PROGRESS"`
+	EmailToError                string  `mapstructure:"EMAIL_TO_ERROR"`
+	EmailToStuck                string  `mapstructure:"EMAIL_TO_STUCK"`
+	EmailToComplete             string  `mapstructure:"EMAIL_TO_COMPLETE"`
+	NotificationTemplatesDir    string  `mapstructure:"NOTIFICATION_TEMPLATES_DIR"`
+	NotificationTimeoutSeconds  int     `mapstructure:"NOTIFICATION_TIMEOUT_SECONDS"`
+	NotificationMaxAttempts     int     `mapstructure:"NOTIFICATION_MAX_ATTEMPTS"`
+	NotificationDeadLetterFile  string  `mapstructure:"NOTIFICATION_DEAD_LETTER_FILE"`
+	ProgressNotifyEveryStacks   int     `mapstructure:"PROGRESS_NOTIFY_EVERY_STACKS"`
+	ProgressNotifyEveryMinutes  int     `mapstructure:"PROGRESS_NOTIFY_EVERY_MINUTES"`
+	ProgressNotifyMinGapMinutes int     `mapstructure:"PROGRESS_NOTIFY_MIN_GAP_MINUTES"`
+	RoleARN                     string  `mapstructure:"ROLE_ARN"`
+	RoleExternalID              string  `mapstructure:"ROLE_EXTERNAL_ID"`
+	RoleSessionName             string  `mapstructure:"ROLE_SESSION_NAME"`
+	RoleMFASerial               string  `mapstructure:"ROLE_MFA_SERIAL"`
+	WebIdentityRoleARN          string  `mapstructure:"WEB_IDENTITY_ROLE_ARN"`
+	WebIdentityTokenFile        string  `mapstructure:"WEB_IDENTITY_TOKEN_FILE"`
+	DryRun                      string  `mapstructure:"DRY_RUN"`
+	EndpointURL                 *string `mapstructure:"ENDPOINT_URL"`
+	ReportFormats               string  `mapstructure:"REPORT_FORMATS"`
+	ReportDir                   string  `mapstructure:"REPORT_DIR"`
+	LogFormat                   string  `mapstructure:"LOG_FORMAT"`
+	LogLevel                    string  `mapstructure:"LOG_LEVEL"`
+	MetricsAddress              string  `mapstructure:"METRICS_ADDRESS"`
+	PushgatewayURL              string  `mapstructure:"PUSHGATEWAY_URL"`
+	PushgatewayJob              string  `mapstructure:"PUSHGATEWAY_JOB"`
+	OTLPEndpoint                string  `mapstructure:"OTLP_ENDPOINT"`
+	StackSetAdminRoleARN        string  `mapstructure:"STACKSET_ADMIN_ROLE_ARN"`
+	StackSetRegion              string  `mapstructure:"STACKSET_REGION"`
+	StackSetCallAs              string  `mapstructure:"STACKSET_CALL_AS"`
+
+	NotifyDryRun                 bool `mapstructure:"NOTIFY_DRY_RUN"`
+	SSMDependencies              bool `mapstructure:"SSM_DEPENDENCIES"`
+	DisableTerminationProtection bool `mapstructure:"DISABLE_TERMINATION_PROTECTION"`
+	RetainFailedResources        bool `mapstructure:"RETAIN_FAILED_RESOURCES"`
+	DeleteStackSetInstances      bool `mapstructure:"DELETE_STACKSET_INSTANCES"`
+	DeleteEmptyStackSets         bool `mapstructure:"DELETE_EMPTY_STACKSETS"`
+	SkipPreflight                bool `mapstructure:"SKIP_PREFLIGHT"`
+	PreflightOnly                bool `mapstructure:"-"` // set by the preflight command to stop after checking permissions
 }
@@ -0,0 +1,29 @@
+#!/bin/bash
+
+set -e
+
+LOCALSTACK_ENDPOINT="${LOCALSTACK_ENDPOINT:-'http://localhost:4566'}"
+
+ARGS="--endpoint-url $LOCALSTACK_ENDPOINT --region us-east-1"
+EVENTS_NAME="cfn-teardown-events"
+
+echo "--- lifecycle event targets creation started ---"
+
+# sns topic -> sqs queue
+topic_arn=$(aws sns create-topic --name $EVENTS_NAME $ARGS --query TopicArn --output text)
+sns_queue_url=$(aws sqs create-queue --queue-name $EVENTS_NAME-sns $ARGS --query QueueUrl --output text)
+sns_queue_arn=$(aws sqs get-queue-attributes --queue-url $sns_queue_url --attribute-names QueueArn $ARGS --query Attributes.QueueArn --output text)
+aws sns subscribe --topic-arn $topic_arn --protocol sqs --notification-endpoint $sns_queue_arn --attributes RawMessageDelivery=true $ARGS > /dev/null
+echo "sns topic created!"
+
+# eventbridge bus -> sqs queue
+aws events create-event-bus --name $EVENTS_NAME $ARGS > /dev/null
+eb_queue_url=$(aws sqs create-queue --queue-name $EVENTS_NAME-eventbridge $ARGS --query QueueUrl --output text)
+eb_queue_arn=$(aws sqs get-queue-attributes --queue-url $eb_queue_url --attribute-names QueueArn $ARGS --query Attributes.QueueArn --output text)
+aws events put-rule --name $EVENTS_NAME --event-bus-name $EVENTS_NAME --event-pattern '{"source":["cfn-teardown"]}' $ARGS > /dev/null
+aws events put-targets --rule $EVENTS_NAME --event-bus-name $EVENTS_NAME --targets "Id=sqs,Arn=$eb_queue_arn" $ARGS > /dev/null
+echo "eventbridge bus created!"
+
+echo "SNS_TOPIC_ARN: $topic_arn
+EVENT_BUS_NAME: $EVENTS_NAME" >> ~/.cfn-teardown.yaml
+echo "--- lifecycle event targets created ---"
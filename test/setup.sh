@@ -29,3 +29,7 @@ echo "binary built!"
 echo "creating test stacks..."
 ./test/create_test_stacks.sh
 echo "stacks created!"
+
+echo "creating lifecycle event targets..."
+./test/create_event_targets.sh
+echo "lifecycle event targets created!"
@@ -60,6 +60,28 @@ function expect_dynamodb_count() {
   fi
 }
 
+# verify lifecycle events received by the queue. Messages are deleted once read.
+# e.g. expect_events 'cfn-teardown-events-sns' '.event' 'RunFinished=1,RunStarted=1'
+function expect_events() {
+  queue_url=$(aws sqs get-queue-url --queue-name $1 $ARGS --query QueueUrl --output text)
+  events=""
+  while true; do
+    messages=$(aws sqs receive-message --queue-url $queue_url --max-number-of-messages 10 --wait-time-seconds 1 $ARGS)
+    if [ -z "$messages" ]; then
+      break
+    fi
+    events="$events $(echo "$messages" | jq -r ".Messages[].Body | fromjson | $2")"
+    for handle in $(echo "$messages" | jq -r '.Messages[].ReceiptHandle'); do
+      aws sqs delete-message --queue-url $queue_url --receipt-handle $handle $ARGS
+    done
+  done
+  got=$(echo $events | tr ' ' '\n' | LC_ALL=C sort | uniq -c | awk '{print $2"="$1}' | paste -sd, -)
+  if [ "$got" != "$3" ]; then
+    echo "expected events in $1: $3, got: $got"
+    exit 1
+  fi
+}
+
 function expect_lambda_count() {
   c=$(aws $ARGS lambda list-functions --query 'Functions | length(@)')
   if [ "$c" != "$1" ]; then
@@ -88,4 +110,7 @@ expect_subnets_count 0
 expect_routetable_count 0
 expect_dynamodb_count 0
 expect_lambda_count 0
+expected_events="RunFinished=1,RunStarted=1,StackDeleteStarted=3,StackDeleted=3"
+expect_events cfn-teardown-events-sns '.event' $expected_events
+expect_events cfn-teardown-events-eventbridge '.detail.event' $expected_events
 echo "all tests passed!"
@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Configs, clients and caller identities are shared by all managers so that credentials are resolved once and
+// account ids are looked up once instead of on every api call.
+var (
+	awsConfigs       = map[string]aws.Config{}
+	configClients    = map[string]interface{}{}
+	callerIdentities = map[string]*sts.GetCallerIdentityOutput{}
+	awsConfigsMutex  sync.Mutex
+)
+
+// NewAWSConfig returns aws-sdk-go-v2 config of the aws profile and region. It is loaded once and shared by all managers.
+// Credentials are taken from the aws profile if given, otherwise from the default credential chain i.e. environment variables,
+// web identity token file(AWS_WEB_IDENTITY_TOKEN_FILE), shared config and ECS or EC2 roles.
+// If WEB_IDENTITY_TOKEN_FILE is set, the web identity role is assumed instead and used as the base credentials.
+// Requests are retried up to AWS_SDK_MAX_RETRY times in adaptive mode which also slows down requests once they are throttled.
+func NewAWSConfig(profile, region string, endpointURL *string) (aws.Config, error) {
+	key := fmt.Sprintf("%v|%v|%v", profile, region, aws.ToString(endpointURL))
+	awsConfigsMutex.Lock()
+	defer awsConfigsMutex.Unlock()
+	if cfg, ok := awsConfigs[key]; ok {
+		return cfg, nil
+	}
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+		config.WithRetryMode(aws.RetryModeAdaptive),
+		// attempts include the first request
+		config.WithRetryMaxAttempts(AWS_SDK_MAX_RETRY + 1),
+		config.WithAPIOptions(instrumentAPIOptions),
+	}
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to load AWS config: %v", err)
+	}
+	// localstack endpoint URL is passed during integration tests, otherwise it is nil
+	cfg.BaseEndpoint = endpointURL
+
+	if credentialOptions.WebIdentityTokenFile != "" {
+		cfg.Credentials = webIdentityCredentials(cfg)
+	}
+	awsConfigs[key] = cfg
+	return cfg, nil
+}
+
+// sharedConfigClient returns the aws-sdk-go-v2 client of a service for the config, using credentials of the role if role arn is provided.
+// Clients are created once per service, profile, region and role and shared by all managers.
+func sharedConfigClient[T any, O any](service, profile string, cfg aws.Config, roleARN string, create func(aws.Config, ...func(*O)) T, optFns ...func(*O)) T {
+	key := fmt.Sprintf("%v|%v|%v|%v|%v", service, profile, cfg.Region, aws.ToString(cfg.BaseEndpoint), roleARN)
+	awsConfigsMutex.Lock()
+	defer awsConfigsMutex.Unlock()
+	if c, ok := configClients[key]; ok {
+		return c.(T)
+	}
+
+	if roleARN != "" {
+		// Create service client value configured for credentials from assumed role
+		cfg = cfg.Copy()
+		cfg.Credentials = RoleCredentials(cfg, profile, roleARN)
+	}
+	c := create(cfg, optFns...)
+	configClients[key] = c
+	return c
+}
+
+// CallerAccountID returns id of the aws account of the config or of the role if role arn is provided.
+// Account id is looked up once per profile, endpoint and role as it does not change between regions.
+func CallerAccountID(ctx context.Context, cfg aws.Config, profile, roleARN string) (string, error) {
+	identity, err := callerIdentity(ctx, cfg, profile, roleARN)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(identity.Account), nil
+}
+
+// callerIdentity returns identity of the config or of the role if role arn is provided. It is looked up once per profile, endpoint and role,
+// same as the role credentials.
+func callerIdentity(ctx context.Context, cfg aws.Config, profile, roleARN string) (*sts.GetCallerIdentityOutput, error) {
+	key := fmt.Sprintf("%v|%v|%v", profile, aws.ToString(cfg.BaseEndpoint), roleARN)
+	awsConfigsMutex.Lock()
+	identity, ok := callerIdentities[key]
+	awsConfigsMutex.Unlock()
+	if ok {
+		return identity, nil
+	}
+
+	identity, err := sharedConfigClient("sts", profile, cfg, roleARN, sts.NewFromConfig).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		Logger.Error("Error requesting AWS caller identity", LOG_ERROR, err)
+		return nil, err
+	}
+
+	awsConfigsMutex.Lock()
+	callerIdentities[key] = identity
+	awsConfigsMutex.Unlock()
+	return identity, nil
+}
+
+// validateTargetAccount makes sure that the aws profile or the default credentials belong to the target account so that we are deleting
+// in the correct aws account. Validation is skipped if the target account id is not provided.
+func validateTargetAccount(ctx context.Context, profile, region string, endpointURL *string, targetAccountID, service string) error {
+	if targetAccountID == "" {
+		return nil
+	}
+	cfg, err := NewAWSConfig(profile, region, endpointURL)
+	if err != nil {
+		return err
+	}
+	accountID, err := CallerAccountID(ctx, cfg, profile, "")
+	if err != nil {
+		return err
+	}
+	if accountID != targetAccountID {
+		return fmt.Errorf("[%v] Target account id (%v) did not match with account id (%v) in the current AWS session", service, targetAccountID, accountID)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// fakeAWSEndpoint serves AWS api requests of the test with the handler and returns its URL to be used as endpoint URL.
+// Static credentials are set so that the default credential chain doesn't look for real ones.
+func fakeAWSEndpoint(t *testing.T, handler http.HandlerFunc) *string {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &server.URL
+}
+
+func TestCallerAccountIDIsCachedPerEndpoint(t *testing.T) {
+	// e.g. LocalStack and real AWS used by the same process
+	localstack := fakeAWSEndpoint(t, (&fakeIAMAccount{callerARN: "arn:aws:iam::000000000000:root", account: "000000000000"}).ServeHTTP)
+	aws := fakeAWSEndpoint(t, (&fakeIAMAccount{callerARN: "arn:aws:iam::121212121212:user/ci", account: "121212121212"}).ServeHTTP)
+
+	for endpoint, expected := range map[*string]string{localstack: "000000000000", aws: "121212121212"} {
+		cfg, err := NewAWSConfig("", "us-east-1", endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accountID, err := CallerAccountID(context.Background(), cfg, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accountID != expected {
+			t.Errorf("expected account %v of endpoint %v, got %v", expected, *endpoint, accountID)
+		}
+	}
+}
@@ -18,15 +18,13 @@ limitations under the License.
 package utils
 
 import (
-	"fmt"
+	"context"
 	"regexp"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 
 	"github.com/nirdosh17/cfn-teardown/models"
 )
@@ -42,159 +40,237 @@ type CFNManager struct {
 }
 
 // DescribeStack returns description for particular stack.
-func (dm CFNManager) DescribeStack(stackName string) (*cloudformation.Stack, error) {
-	cfn, err := dm.Session()
+func (dm CFNManager) DescribeStack(ctx context.Context, stackName string) (*types.Stack, error) {
+	cfn, err := dm.Session(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := cfn.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: &stackName})
+	resp, err := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: &stackName})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Stacks[0], err
+	return &resp.Stacks[0], err
 }
 
 // ListStackResources lists description of all resources in a stack.
-func (dm CFNManager) ListStackResources(stackName string) ([]*cloudformation.StackResourceSummary, error) {
-	cfn, err := dm.Session()
+func (dm CFNManager) ListStackResources(ctx context.Context, stackName string) ([]types.StackResourceSummary, error) {
+	cfn, err := dm.Session(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	allResources := []*cloudformation.StackResourceSummary{}
-	resp, err := cfn.ListStackResources(&cloudformation.ListStackResourcesInput{StackName: &stackName})
-	if err != nil {
-		return nil, err
-	}
-	allResources = append(allResources, resp.StackResourceSummaries...)
-
-	nextToken := resp.NextToken
-	for nextToken != nil {
-		// sending next token for pagination
-		resp, err := cfn.ListStackResources(&cloudformation.ListStackResourcesInput{StackName: &stackName, NextToken: nextToken})
+	allResources := []types.StackResourceSummary{}
+	paginator := cloudformation.NewListStackResourcesPaginator(cfn, &cloudformation.ListStackResourcesInput{StackName: &stackName})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			break
+			Logger.Error("Error listing resources of stack", LOG_STACK, stackName, LOG_ERROR, err)
+			return allResources, err
 		}
-		allResources = append(allResources, resp.StackResourceSummaries...)
-		nextToken = resp.NextToken
-	}
-
-	if err != nil {
-		fmt.Printf("Error listing resources of stack '%v': %v\n", stackName, err)
+		allResources = append(allResources, page.StackResourceSummaries...)
 	}
-
-	return resp.StackResourceSummaries, err
+	return allResources, nil
 }
 
 // ListImports lists all stacks importing given exported names.
-func (dm CFNManager) ListImports(exportNames []string) (map[string]struct{}, error) {
+func (dm CFNManager) ListImports(ctx context.Context, exportNames []string) (map[string]struct{}, error) {
 	importers := make(map[string]struct{})
-	var err error
-	cfn, err := dm.Session()
+	cfn, err := dm.Session(ctx)
 	if err != nil {
 		return importers, err
 	}
 
 	for _, export := range exportNames {
-		resp, err := cfn.ListImports(&cloudformation.ListImportsInput{ExportName: &export})
-		if err != nil {
-			// no imports = eligible for deletion
-			if !strings.Contains(err.Error(), "is not imported by any stack") {
+		paginator := cloudformation.NewListImportsPaginator(cfn, &cloudformation.ListImportsInput{ExportName: aws.String(export)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				// no imports = eligible for deletion
+				if strings.Contains(err.Error(), "is not imported by any stack") {
+					break
+				}
 				return importers, err
 			}
+			for _, stackName := range page.Imports {
+				// using map for faster access and empty struct due to its null memory consumption
+				importers[stackName] = struct{}{}
+			}
 		}
-		for _, stackName := range resp.Imports {
-			// using map for faster access and empty struct due to its null memory consumption
-			importers[*stackName] = struct{}{}
-		}
 	}
 
-	return importers, err
+	return importers, nil
+}
+
+// GetTemplateBody returns the original template of a stack i.e. before transforms are applied.
+func (dm CFNManager) GetTemplateBody(ctx context.Context, stackName string) (string, error) {
+	cfn, err := dm.Session(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := cfn.GetTemplate(ctx, &cloudformation.GetTemplateInput{StackName: &stackName, TemplateStage: types.TemplateStageOriginal})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(resp.TemplateBody), nil
 }
 
 // DeleteStack sends delete request for a stack.
 // Returns success if the stack we are trying to delete has already been deleted.
-func (dm CFNManager) DeleteStack(stackName string) error {
-	fmt.Printf("Submitting delete request for stack: %v\n", stackName)
-	cfn, err := dm.Session()
+func (dm CFNManager) DeleteStack(ctx context.Context, stackName string) error {
+	Logger.Info("Submitting delete request for stack", LOG_STACK, stackName)
+	cfn, err := dm.Session(ctx)
 	if err != nil {
 		return err
 	}
 	input := cloudformation.DeleteStackInput{StackName: &stackName}
 	// stack delete output is an empty struct
-	_, err = cfn.DeleteStack(&input)
+	_, err = cfn.DeleteStack(ctx, &input)
 
 	// No error only means that the delete request was sent
 	// It does not guarantee that the stack will be deleted
 	return err
 }
 
-// ListEnvironmentStacks lists matching stacks for the given regex.
-func (dm CFNManager) ListEnvironmentStacks() (map[string]models.StackDetails, error) {
-	CFNConsoleBaseURL := "https://console.aws.amazon.com/cloudformation/home?region=" + dm.AWSRegion + "#/stacks/stackinfo?stackId="
-
-	// using stack name as key for easy traversal
-	envStacks := map[string]models.StackDetails{}
-
-	cfn, err := dm.Session()
+// DeleteStackRetainingResources sends delete request for a stack in DELETE_FAILED state
+// while skipping deletion of the given resources. Retained resources are left as is in the aws account.
+func (dm CFNManager) DeleteStackRetainingResources(ctx context.Context, stackName string, logicalResourceIds []string) error {
+	Logger.Info("Submitting delete request for stack retaining resources", LOG_STACK, stackName, "retained_resources", strings.Join(logicalResourceIds, ", "))
+	cfn, err := dm.Session(ctx)
 	if err != nil {
-		return envStacks, err
+		return err
 	}
+	input := cloudformation.DeleteStackInput{StackName: &stackName, RetainResources: logicalResourceIds}
+	_, err = cfn.DeleteStack(ctx, &input)
+	return err
+}
 
-	input := cloudformation.ListStacksInput{StackStatusFilter: models.ActiveStatuses}
-	// only returns first 100 stacks. Need to use NextToken
-	listStackOutput, err := cfn.ListStacks(&input)
+// ListFailedResources lists resources which failed to delete in the latest delete attempt of a stack.
+// Stack events are returned newest first, so the events are scanned until the DELETE_IN_PROGRESS event
+// of the stack itself which marks the beginning of the latest delete attempt.
+func (dm CFNManager) ListFailedResources(ctx context.Context, stackName string) ([]models.FailedResource, error) {
+	failedResources := []models.FailedResource{}
+	cfn, err := dm.Session(ctx)
 	if err != nil {
-		return envStacks, err
+		return failedResources, err
 	}
 
-	for _, details := range listStackOutput.StackSummaries {
-		// select stacks of our concern
-		stackName := *details.StackName
-		if dm.RegexMatch(stackName) {
-			sd := models.StackDetails{
-				StackName:      stackName,
-				Status:         *details.StackStatus,
-				CFNConsoleLink: (CFNConsoleBaseURL + stackName),
+	seen := map[string]struct{}{}
+	paginator := cloudformation.NewDescribeStackEventsPaginator(cfn, &cloudformation.DescribeStackEventsInput{StackName: &stackName})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			Logger.Error("Error listing events of stack", LOG_STACK, stackName, LOG_ERROR, err)
+			return failedResources, err
+		}
+		for _, event := range page.StackEvents {
+			logicalId := aws.ToString(event.LogicalResourceId)
+			status := event.ResourceStatus
+			if aws.ToString(event.ResourceType) == "AWS::CloudFormation::Stack" && logicalId == stackName {
+				if status == types.ResourceStatusDeleteInProgress {
+					// reached the start of the latest delete attempt
+					return failedResources, nil
+				}
+				continue
+			}
+
+			if status != types.ResourceStatusDeleteFailed {
+				continue
 			}
-			envStacks[stackName] = sd
+			// a resource can fail multiple times within an attempt, latest event is the one we are interested in
+			if _, ok := seen[logicalId]; ok {
+				continue
+			}
+			seen[logicalId] = struct{}{}
+
+			failedResources = append(failedResources, models.FailedResource{
+				LogicalResourceId:  logicalId,
+				PhysicalResourceId: aws.ToString(event.PhysicalResourceId),
+				ResourceType:       aws.ToString(event.ResourceType),
+				StatusReason:       aws.ToString(event.ResourceStatusReason),
+				Cause:              ClassifyFailure(aws.ToString(event.ResourceStatusReason)),
+			})
 		}
 	}
+	return failedResources, nil
+}
 
-	// FIX: this condition is unreachable
+// failureCausePatterns maps common failure causes to the substrings found in the status reason of failed resources.
+// Patterns are matched in lower case and the first matching cause is picked.
+var failureCausePatterns = []struct {
+	cause    string
+	patterns []string
+}{
+	{models.ACCESS_DENIED, []string{"accessdenied", "access denied", "not authorized", "unauthorizedoperation"}},
+	{models.DEPENDENCY_VIOLATION, []string{"dependencyviolation", "has a dependent object", "has dependencies", "dependent object"}},
+	{models.RESOURCE_NOT_EMPTY, []string{"bucketnotempty", "not empty", "repositorynotempty", "hostedzonenotempty"}},
+	{models.RESOURCE_IN_USE, []string{"resourceinuse", "in use", "being used", "currently used"}},
+}
+
+// ClassifyFailure derives the cause of a resource deletion failure from its status reason.
+func ClassifyFailure(statusReason string) string {
+	reason := strings.ToLower(statusReason)
+	for _, fc := range failureCausePatterns {
+		for _, pattern := range fc.patterns {
+			if strings.Contains(reason, pattern) {
+				return fc.cause
+			}
+		}
+	}
+	return models.UNKNOWN
+}
+
+// DisableTerminationProtection turns off termination protection of a stack so that it can be deleted.
+func (dm CFNManager) DisableTerminationProtection(ctx context.Context, stackName string) error {
+	cfn, err := dm.Session(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = cfn.UpdateTerminationProtection(ctx, &cloudformation.UpdateTerminationProtectionInput{
+		StackName:                   &stackName,
+		EnableTerminationProtection: aws.Bool(false),
+	})
+	return err
+}
+
+// ListEnvironmentStacks lists matching stacks for the given regex.
+func (dm CFNManager) ListEnvironmentStacks(ctx context.Context) (map[string]models.StackDetails, error) {
+	CFNConsoleBaseURL := "https://console.aws.amazon.com/cloudformation/home?region=" + dm.AWSRegion + "#/stacks/stackinfo?stackId="
+
+	// using stack name as key for easy traversal
+	envStacks := map[string]models.StackDetails{}
+
+	cfn, err := dm.Session(ctx)
 	if err != nil {
-		fmt.Printf("Failed listing stacks with pattern: '%v', Error: '%v'\n", dm.StackPattern, err)
 		return envStacks, err
 	}
 
-	nextToken := listStackOutput.NextToken
-	for nextToken != nil {
-		// sending next token for pagination
-		input = cloudformation.ListStacksInput{NextToken: nextToken, StackStatusFilter: models.ActiveStatuses}
-		listStackOutput, err = cfn.ListStacks(&input)
+	statusFilter := []types.StackStatus{}
+	for _, status := range models.ActiveStatuses {
+		statusFilter = append(statusFilter, types.StackStatus(*status))
+	}
+	paginator := cloudformation.NewListStacksPaginator(cfn, &cloudformation.ListStacksInput{StackStatusFilter: statusFilter})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			break
+			Logger.Error("Error listing environment stacks", "stack_pattern", dm.StackPattern, LOG_ERROR, err)
+			return envStacks, err
 		}
-		for _, details := range listStackOutput.StackSummaries {
+		for _, details := range page.StackSummaries {
 			// select stacks of our concern
-			stackName := *details.StackName
+			stackName := aws.ToString(details.StackName)
 			if dm.RegexMatch(stackName) {
-				sd := models.StackDetails{
+				envStacks[stackName] = models.StackDetails{
 					StackName:      stackName,
-					Status:         *details.StackStatus,
+					Region:         dm.AWSRegion,
+					Status:         string(details.StackStatus),
 					CFNConsoleLink: (CFNConsoleBaseURL + stackName),
 				}
-				envStacks[stackName] = sd
 			}
 		}
-		nextToken = listStackOutput.NextToken
-	}
-
-	if err != nil {
-		fmt.Printf("Error listing '%v' environment stacks: %v\n", dm.StackPattern, err)
 	}
-	return envStacks, err
+	return envStacks, nil
 }
 
 // ListEnvironmentExports finds all exported values for our matching stacks in this format:
@@ -203,50 +279,28 @@ func (dm CFNManager) ListEnvironmentStacks() (map[string]models.StackDetails, er
 //	 	 "stack-1-name": ["export-1", "export-2"],
 //	  	"stack-2-name": []
 //		}
-func (dm CFNManager) ListEnvironmentExports() (map[string][]string, error) {
+func (dm CFNManager) ListEnvironmentExports(ctx context.Context) (map[string][]string, error) {
 	exports := map[string][]string{}
 
-	cfn, err := dm.Session()
+	cfn, err := dm.Session(ctx)
 	if err != nil {
 		return exports, err
 	}
 
-	input := cloudformation.ListExportsInput{}
-	// only returns first 100 stacks. Need to use NextToken
-	listExportOutput, err := cfn.ListExports(&input)
-
-	for _, details := range listExportOutput.Exports {
-		stackArn := *details.ExportingStackId
-		stackName := strings.Split(stackArn, "/")[1]
-		exportName := *details.Name
-		exports[stackName] = append(exports[stackName], exportName)
-	}
-
-	if err != nil {
-		fmt.Printf("Error listing '%v' environment stack exports: %v\n", dm.StackPattern, err)
-		return exports, err
-	}
-
-	nextToken := listExportOutput.NextToken
-
-	for nextToken != nil {
-		// sending next token for pagination
-		input := cloudformation.ListExportsInput{NextToken: nextToken}
-		listExportOutput, err = cfn.ListExports(&input)
-
+	paginator := cloudformation.NewListExportsPaginator(cfn, &cloudformation.ListExportsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			break
+			Logger.Error("Error listing environment stack exports", "stack_pattern", dm.StackPattern, LOG_ERROR, err)
+			return exports, err
 		}
-
-		for _, details := range listExportOutput.Exports {
-			stackArn := *details.ExportingStackId
+		for _, details := range page.Exports {
+			stackArn := aws.ToString(details.ExportingStackId)
 			stackName := strings.Split(stackArn, "/")[1]
-			exportName := *details.Name
-			exports[stackName] = append(exports[stackName], exportName)
+			exports[stackName] = append(exports[stackName], aws.ToString(details.Name))
 		}
-		nextToken = listExportOutput.NextToken
 	}
-	return exports, err
+	return exports, nil
 }
 
 // RegexMatch matches stack name with the supplied regex so that we can filter desired stacks for deletion.
@@ -255,56 +309,25 @@ func (dm CFNManager) RegexMatch(stackName string) bool {
 	return match
 }
 
-// Session creates a new aws cloudformation session.
-// By default it uses given aws profile and region but it also provides option to assume a different role.
+// Session returns the shared aws cloudformation client.
+// By default it uses given aws profile or the default credential chain but it also provides option to assume a different role.
 // It also has validation for target account id to ensure we are deleting in the correct aws account.
-func (dm CFNManager) Session() (*cloudformation.CloudFormation, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-			Region: aws.String(dm.AWSRegion),
-			// localstack endpoint URL is passed during integration tests, otherwise it is nil
-			Endpoint: dm.EndpointURL,
-		},
-		SharedConfigState: session.SharedConfigEnable,
-		Profile:           dm.AWSProfile,
-	}))
-
-	// validation for target account id
-	if dm.TargetAccountId != "" {
-		aID, err := dm.AWSSessionAccountID(sess)
-		if err != nil {
-			fmt.Printf("Error requesting AWS caller identity: %v", err.Error())
-			return nil, err
-		}
-
-		if aID != dm.TargetAccountId {
-			return nil, fmt.Errorf(
-				"[CFN] Target account id (%v) did not match with account id (%v) in the current AWS session",
-				dm.TargetAccountId,
-				aID,
-			)
-		}
+func (dm CFNManager) Session(ctx context.Context) (*cloudformation.Client, error) {
+	if err := validateTargetAccount(ctx, dm.AWSProfile, dm.AWSRegion, dm.EndpointURL, dm.TargetAccountId, "CFN"); err != nil {
+		return nil, err
 	}
-
-	if dm.NukeRoleARN == "" {
-		// this means, we are using given aws profile
-		return cloudformation.New(sess), nil
+	cfg, err := NewAWSConfig(dm.AWSProfile, dm.AWSRegion, dm.EndpointURL)
+	if err != nil {
+		return nil, err
 	}
-
-	// Create the credentials from AssumeRoleProvider if nuke role arn is provided
-	creds := stscreds.NewCredentials(sess, dm.NukeRoleARN)
-	// Create service client value configured for credentials from assumed role.
-	return cloudformation.New(sess, &aws.Config{Credentials: creds, MaxRetries: &AWS_SDK_MAX_RETRY}), nil
+	return sharedConfigClient("cloudformation", dm.AWSProfile, cfg, dm.NukeRoleARN, cloudformation.NewFromConfig), nil
 }
 
-// AWSSessionAccountID fetches account id from current aws session
-func (dm CFNManager) AWSSessionAccountID(sess *session.Session) (acID string, err error) {
-	svc := sts.New(sess)
-	result, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+// AccountID returns id of the aws account where the stacks are being deleted i.e. account of the assumed role if role arn is provided.
+func (dm CFNManager) AccountID(ctx context.Context) (string, error) {
+	cfg, err := NewAWSConfig(dm.AWSProfile, dm.AWSRegion, dm.EndpointURL)
 	if err != nil {
-		fmt.Printf("Error requesting AWS caller identity: %v", err.Error())
-		return
+		return "", err
 	}
-	acID = *result.Account
-	return
+	return CallerAccountID(ctx, cfg, dm.AWSProfile, dm.NukeRoleARN)
 }
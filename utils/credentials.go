@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// DEFAULT_ROLE_SESSION_NAME is the session name of assumed roles unless ROLE_SESSION_NAME is set.
+const DEFAULT_ROLE_SESSION_NAME = "cfn-teardown"
+
+// CredentialOptions configures how credentials of all AWS sessions are obtained.
+type CredentialOptions struct {
+	WebIdentityRoleARN   string // role assumed with the web identity token e.g. OIDC token of a CI job
+	WebIdentityTokenFile string
+	RoleSessionName      string
+	RoleExternalID       string // passed while assuming ROLE_ARN, roles of the accounts manifest and the StackSet administrator role
+	RoleMFASerial        string // MFA device of the caller, token code is prompted on stdin when the role is assumed
+}
+
+var (
+	credentialOptions = CredentialOptions{RoleSessionName: DEFAULT_ROLE_SESSION_NAME}
+
+	// assumed role credentials are cached so that roles are not assumed again and MFA token is not prompted on every api call
+	roleCredentials      = map[string]aws.CredentialsProvider{}
+	roleCredentialsMutex sync.Mutex
+)
+
+// SetCredentialOptions configures credentials of AWS sessions created afterwards. It is called once at startup.
+func SetCredentialOptions(config models.Config) {
+	credentialOptions = CredentialOptions{
+		WebIdentityRoleARN:   config.WebIdentityRoleARN,
+		WebIdentityTokenFile: config.WebIdentityTokenFile,
+		RoleSessionName:      config.RoleSessionName,
+		RoleExternalID:       config.RoleExternalID,
+		RoleMFASerial:        config.RoleMFASerial,
+	}
+	if credentialOptions.RoleSessionName == "" {
+		credentialOptions.RoleSessionName = DEFAULT_ROLE_SESSION_NAME
+	}
+}
+
+// webIdentityCredentials returns credentials of the web identity role assumed with the token of WEB_IDENTITY_TOKEN_FILE.
+func webIdentityCredentials(cfg aws.Config) aws.CredentialsProvider {
+	return cachedCredentials("web-identity|"+credentialOptions.WebIdentityRoleARN, func() aws.CredentialsProvider {
+		return stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), credentialOptions.WebIdentityRoleARN, stscreds.IdentityTokenFile(credentialOptions.WebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = credentialOptions.RoleSessionName
+		})
+	})
+}
+
+// RoleCredentials returns credentials of the role assumed using credentials of the config i.e. roles are chained on top of the
+// profile, default credential chain or web identity role. External id, session name and MFA of the credential options are applied.
+// Credentials are cached per base profile and endpoint as the same role can be assumed from different profiles.
+func RoleCredentials(cfg aws.Config, profile, roleARN string) aws.CredentialsProvider {
+	key := fmt.Sprintf("role|%v|%v|%v", profile, aws.ToString(cfg.BaseEndpoint), roleARN)
+	return cachedCredentials(key, func() aws.CredentialsProvider {
+		return stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = credentialOptions.RoleSessionName
+			if credentialOptions.RoleExternalID != "" {
+				o.ExternalID = aws.String(credentialOptions.RoleExternalID)
+			}
+			if credentialOptions.RoleMFASerial != "" {
+				o.SerialNumber = aws.String(credentialOptions.RoleMFASerial)
+				o.TokenProvider = stscreds.StdinTokenProvider
+			}
+		})
+	})
+}
+
+// cachedCredentials returns credentials cached under the key or creates them.
+func cachedCredentials(key string, create func() aws.CredentialsProvider) aws.CredentialsProvider {
+	roleCredentialsMutex.Lock()
+	defer roleCredentialsMutex.Unlock()
+	if creds, ok := roleCredentials[key]; ok {
+		return creds
+	}
+	creds := aws.NewCredentialsCache(create())
+	roleCredentials[key] = creds
+	return creds
+}
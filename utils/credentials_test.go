@@ -0,0 +1,48 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestRoleCredentialsAreCachedPerProfile(t *testing.T) {
+	roleARN := "arn:aws:iam::121212121212:role/cfn-teardown"
+	cfg := aws.Config{Region: "us-east-1"}
+
+	dev := RoleCredentials(cfg, "dev", roleARN)
+	if RoleCredentials(cfg, "dev", roleARN) != dev {
+		t.Error("expected credentials of the same profile and role to be shared")
+	}
+	if RoleCredentials(aws.Config{Region: "eu-west-1"}, "dev", roleARN) != dev {
+		t.Error("expected credentials of the role to be shared across regions")
+	}
+	if RoleCredentials(cfg, "prod", roleARN) == dev {
+		t.Error("expected credentials of the role assumed from another profile not to be shared")
+	}
+	if RoleCredentials(cfg, "", roleARN) == dev {
+		t.Error("expected credentials of the role assumed from the default credential chain not to be shared")
+	}
+
+	localstack := cfg.Copy()
+	localstack.BaseEndpoint = aws.String("http://localhost:4566")
+	if RoleCredentials(localstack, "dev", roleARN) == dev {
+		t.Error("expected credentials of the role assumed from another endpoint not to be shared")
+	}
+}
@@ -18,18 +18,27 @@ limitations under the License.
 package utils
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/gookit/color"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/nirdosh17/cfn-teardown/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
+	// RUN_ID uniquely identifies a teardown run in notifications and reports.
+	RUN_ID = NewRunID()
+
 	// NUKE_START_TIME is the start timestamp of teardown.
 	NUKE_START_TIME = CurrentUTCDateTime()
 
@@ -55,20 +64,97 @@ var (
 // InitiateTearDown scans and deletes cloudformation stacks respecting the dependencies.
 // A stack is eligible for deletion when it's exports has not been imported by any other stacks.
 func InitiateTearDown(config models.Config) {
-	cfn := CFNManager{StackPattern: config.StackPattern, TargetAccountId: config.TargetAccountId, NukeRoleARN: config.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: config.AWSRegion, EndpointURL: config.EndpointURL}
-	s3 := S3Manager{TargetAccountId: config.TargetAccountId, NukeRoleARN: config.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: config.AWSRegion, EndpointURL: config.EndpointURL}
-	notifier := NotificationManager{StackPattern: config.StackPattern, SlackWebHookURL: config.SlackWebhookURL, DryRun: config.DryRun}
+	// json logs carry run id in every line
+	if _, ok := Logger.Handler().(*ColorHandler); ok {
+		Logger.Info("Run ID: " + RUN_ID)
+	}
+
+	SetCredentialOptions(config)
+
+	targets, err := ParseTargets(config, ParseRegions(config.AWSRegions, config.AWSRegion))
+	if err != nil {
+		Logger.Error("Invalid accounts manifest", LOG_ERROR, err)
+		os.Exit(1)
+	}
+	if len(targets) == 0 {
+		Logger.Error("No AWS region to delete stacks from. Set AWS_REGION or AWS_REGIONS")
+		os.Exit(1)
+	}
+	regions := TargetRegions(targets)
+	regionOrder, err := ParseRegionOrder(config.RegionOrder, regions)
+	if err != nil {
+		Logger.Error("Invalid region order", LOG_ERROR, err)
+		os.Exit(1)
+	}
+	stackDependencies, err := ParseStackDependencies(config.StackDependencies)
+	if err != nil {
+		Logger.Error("Invalid stack dependencies", LOG_ERROR, err)
+		os.Exit(1)
+	}
+	// AWS_REGION is optional with AWS_REGIONS, the first region is used for account lookup and lifecycle events then
+	if config.AWSRegion == "" {
+		config.AWSRegion = regions[0]
+	}
+	config.AWSRegions = strings.Join(regions, ",")
+
+	managers := map[string]TargetManagers{}
+	for _, target := range targets {
+		managers[target.Key()] = NewTargetManagers(config, target)
+	}
+	cfn := NewTargetManagers(config, Target{RoleARN: config.RoleARN, Region: config.AWSRegion}).CFN
+	stackSets, err := NewStackSetManager(config)
+	if err != nil {
+		Logger.Error("Invalid StackSet configuration", LOG_ERROR, err)
+		os.Exit(1)
+	}
+
+	reportFormats, err := ParseReportFormats(config.ReportFormats)
+	if err != nil {
+		Logger.Error("Invalid report formats", LOG_ERROR, err)
+		os.Exit(1)
+	}
+	config.ReportFormats = strings.Join(reportFormats, ",")
+
+	if config.MetricsAddress != "" {
+		StartMetricsServer(config.MetricsAddress)
+	}
+	SetRunStatus(RUN_RUNNING)
+
+	runTrace, err := StartRunTrace(config)
+	if err != nil {
+		Logger.Error("Unable to set up tracing", LOG_ERROR, err)
+		os.Exit(1)
+	}
+
+	notifier, err := NewNotificationManager(config)
+	if err != nil {
+		Logger.Error("Unable to load notification templates", LOG_ERROR, err)
+		os.Exit(1)
+	}
+
+	// stacks of all accounts listed in the manifest are reported together
+	accountID := strings.Join(TargetAccountIDs(targets), ", ")
+	if accountID == "" {
+		accountID, err = cfn.AccountID(runTrace.Context())
+		if err != nil {
+			Logger.Warn("Unable to find AWS account id for notifications", LOG_ERROR, err)
+		}
+	}
+	notifier.Context.AccountID = accountID
+	notifier.Context.Region = strings.Join(regions, ", ")
+	runTrace.SetAccountID(accountID)
 
 	var dependencyTree = map[string]models.StackDetails{}
 
 	// generate dependencies for matching stacks
-	dt, err := prepareDependencyTree(config.StackPattern, cfn)
+	dt, err := discoverStacks(runTrace.Context(), config, targets, regionOrder, stackDependencies, managers)
 
 	if err != nil {
 		UpdateNukeStats(dependencyTree)
 		msg := fmt.Sprintf("Unable to prepare dependencies. Error: %v", err.Error())
 		notifier.ErrorAlert(AlertMessage{Message: msg})
-		color.Error.Println(msg)
+		Logger.Error("Unable to prepare dependencies", LOG_ERROR, err)
+		finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 		os.Exit(1)
 	}
 	dependencyTree = dt // need to do this for global scope
@@ -79,71 +165,209 @@ func InitiateTearDown(config models.Config) {
 
 	if ACTIVE_STACK_COUNT == 0 {
 		UpdateNukeStats(dependencyTree)
-		color.Yellow.Printf("\nNo matching stacks to delete! Stack count: %v\n", TOTAL_STACK_COUNT)
+		Logger.Warn("No matching stacks to delete!", "stack_count", TOTAL_STACK_COUNT)
 		notifier.SuccessAlert(AlertMessage{})
+		finishTeardown(config, runTrace, dependencyTree, RUN_SUCCEEDED, "No matching stacks to delete", accountID)
 		return
 	}
 
-	fmt.Println()
-	fmt.Printf("Following stacks are eligible for deletion | Stack count: %v\n", ACTIVE_STACK_COUNT)
-	for stackName := range dependencyTree {
-		color.Gray.Println(" -", stackName)
+	Logger.Info("Following stacks are eligible for deletion", "stack_count", ACTIVE_STACK_COUNT)
+	protectedStacks := []string{}
+	stackSetStacks := []string{}
+	for stackName, stack := range dependencyTree {
+		if stack.TerminationProtection && stack.Status != models.DELETE_COMPLETE {
+			protectedStacks = append(protectedStacks, stackName)
+			Logger.Warn(" - "+stackName, LOG_STACK, stackName, LOG_STATUS, stack.Status, "termination_protection", true)
+			continue
+		}
+		if stack.StackSetName != "" && stack.Status != models.DELETE_COMPLETE {
+			stackSetStacks = append(stackSetStacks, stackName)
+			Logger.Warn(" - "+stackName, LOG_STACK, stackName, LOG_STATUS, stack.Status, "stack_set", stack.StackSetName)
+			continue
+		}
+		Logger.Info(" - "+stackName, LOG_STACK, stackName, LOG_STATUS, stack.Status)
+	}
+	Logger.Info("Check 'stack_teardown_details.json' file for more details.")
+
+	if len(protectedStacks) > 0 {
+		if config.DisableTerminationProtection {
+			Logger.Warn("Termination protection will be disabled right before deleting these stacks", "stacks", strings.Join(protectedStacks, ", "))
+		} else {
+			Logger.Warn("Following stacks have termination protection enabled and can't be deleted. Set 'DISABLE_TERMINATION_PROTECTION' to true to disable it before deletion.", "stacks", strings.Join(protectedStacks, ", "))
+		}
+	}
+
+	if len(stackSetStacks) > 0 {
+		if config.DeleteStackSetInstances {
+			Logger.Warn("Following stacks are managed by StackSets and will be deleted by removing their stack instances", "stacks", strings.Join(stackSetStacks, ", "), "stack_set_region", stackSets.AWSRegion)
+		} else {
+			Logger.Warn("Following stacks are managed by StackSets and can't be deleted directly. Set 'DELETE_STACKSET_INSTANCES' to true to remove their stack instances from the StackSets.", "stacks", strings.Join(stackSetStacks, ", "))
+		}
+	}
+
+	// missing permissions would fail the teardown halfway, so they are found out before anything is deleted.
+	// Dry runs don't delete anything, so the check only runs there when asked for by the preflight command.
+	preflight := PreflightReport{}
+	if (config.DryRun == "false" && !config.SkipPreflight) || config.PreflightOnly {
+		Logger.Info("Checking permissions needed for the teardown...")
+		_, span := Tracer.Start(runTrace.Context(), "Preflight")
+		preflight, err = RunPreflight(runTrace.Context(), config, dependencyTree, managers, stackSets)
+		endSpan(span, err)
+		if err != nil && config.PreflightOnly {
+			Logger.Error("Unable to check permissions needed for the teardown", LOG_ERROR, err)
+			runTrace.End(dependencyTree, RUN_FAILED, err.Error())
+			os.Exit(1)
+		}
+		if err != nil {
+			Logger.Warn("Unable to check permissions needed for the teardown. Set 'SKIP_PREFLIGHT' to true to skip the check.", LOG_ERROR, err)
+		} else {
+			printPreflight(preflight)
+		}
+	}
+
+	if config.PreflightOnly {
+		if len(preflight.Missing) > 0 {
+			runTrace.End(dependencyTree, RUN_FAILED, fmt.Sprintf("Missing %v permissions needed for the teardown", len(preflight.Missing)))
+			os.Exit(1)
+		}
+		runTrace.End(dependencyTree, RUN_SUCCEEDED, "")
+		return
 	}
-	color.Style{color.Yellow, color.OpItalic}.Println("\nCheck 'stack_teardown_details.json' file for more details.")
-	fmt.Println()
 
 	// safety check for accidental run
 	if config.DryRun != "false" {
+		plan := BuildPlan(dependencyTree, cfn, config.DisableTerminationProtection, config.DeleteStackSetInstances)
+		printPlan(plan)
+		notifier.PlanAlert(AlertMessage{Plan: plan})
+		runTrace.End(dependencyTree, RUN_SUCCEEDED, "")
 		return
 	}
 
+	// deleting these stacks would just exhaust all retries, so failing early before anything is deleted
+	if len(protectedStacks) > 0 && !config.DisableTerminationProtection {
+		msg := fmt.Sprintf("Stacks with termination protection enabled can't be deleted: %v", strings.Join(protectedStacks, ", "))
+		notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: dependencyTree[protectedStacks[0]]})
+		Logger.Error(msg)
+		finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+		os.Exit(1)
+	}
+
+	if len(stackSetStacks) > 0 && !config.DeleteStackSetInstances {
+		msg := fmt.Sprintf("Stacks managed by StackSets can't be deleted directly: %v", strings.Join(stackSetStacks, ", "))
+		notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: dependencyTree[stackSetStacks[0]]})
+		Logger.Error(msg)
+		finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+		os.Exit(1)
+	}
+
+	if len(preflight.Missing) > 0 {
+		msg := fmt.Sprintf("Missing %v permissions needed for the teardown: %v", len(preflight.Missing), strings.Join(preflight.Blockers(), "; "))
+		notifier.ErrorAlert(AlertMessage{Message: msg})
+		Logger.Error("Missing permissions needed for the teardown", "missing_count", len(preflight.Missing))
+		finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+		os.Exit(1)
+	}
+
 	msg := fmt.Sprintf("Waiting for `%v minutes` before starting deletion. Abort if necessary.", config.AbortWaitTimeMinutes)
 	notifier.StartAlert(AlertMessage{Message: msg})
-	color.Red.Println(msg)
+	Logger.Warn("Waiting before starting deletion. Abort if necessary.", "wait_minutes", config.AbortWaitTimeMinutes)
 	time.Sleep(time.Duration(config.AbortWaitTimeMinutes) * time.Minute)
-	color.Green.Println("\n\n---------------------------- Deletion Started -------------------------------")
+	Logger.Info("---------------------------- Deletion Started -------------------------------")
+	progress := ProgressTracker{
+		EveryStacks: config.ProgressNotifyEveryStacks,
+		Interval:    time.Duration(config.ProgressNotifyEveryMinutes) * time.Minute,
+		MinGap:      time.Duration(config.ProgressNotifyMinGapMinutes) * time.Minute,
+	}
+	progress.Start(time.Now())
 	for {
 		// Algorithm:
 		// 1. Scan stacks who has zero importing stacks i.e. last leaf in the dependency tree
 		toDelete := stacksEligibleToDelete(dependencyTree)
 
 		// 2. Delete stacks
-		//    2.1 If stack has S3 bucket resource, then delete bucket contents first
+		//    2.1 If stack has S3 bucket, ECR repository or Route53 hosted zone resources, then delete their contents first
 		//    2.2 Then send request to delete stack
 		//    2.3 Change stack status to DELETE_IN_PROGRESS
-		fmt.Println("\n-----------------------------------------------------------------------------")
-		fmt.Printf("Searching stacks with no importers(dependencies): %v\n", len(toDelete))
+		Logger.Info("Searching stacks with no importers(dependencies)", "stack_count", len(toDelete))
+		// StackSets run one operation at a time, other stack instances of a StackSet are removed in the next rounds.
+		// Operations requested in earlier rounds may still be running, so their stack instances are not even emptied.
+		busyStackSets := stackSetsWithRunningOperations(dependencyTree)
 		for _, sName := range toDelete {
 			stack := dependencyTree[sName]
-			bktErr := deleteBucketIfPresent(sName, cfn, s3)
-			if bktErr != nil {
-				stack.StackStatusReason = bktErr.Error()
+			m := managers[StackTarget(stack).Key()]
+			if stack.StackSetName != "" && busyStackSets[stack.StackSetName] {
+				Logger.Info("Stack queued until the running operation of its StackSet has finished", LOG_STACK, sName, "stack_set", stack.StackSetName)
+				continue
+			}
+			stackCtx := runTrace.StackStarted(stack)
+			stack, emptyErr := emptyResourcesIfPresent(stackCtx, stack, m)
+			if emptyErr != nil {
+				stack.StackStatusReason = emptyErr.Error()
+				dependencyTree[sName] = stack
+				writeToJSON(config.StackPattern, dependencyTree)
 				UpdateNukeStats(dependencyTree)
-				msg := fmt.Sprintf("Unable to empty bucket from stack '%v'", sName)
+				msg := fmt.Sprintf("Unable to empty resources from stack '%v'", sName)
 				notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
-				color.Error.Println(msg)
+				Logger.Error("Unable to empty resources from stack", LOG_STACK, sName, LOG_ERROR, emptyErr)
+				finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 				os.Exit(1)
 			}
 
-			err := cfn.DeleteStack(sName)
+			if stack.TerminationProtection && config.DisableTerminationProtection {
+				err := m.CFN.DisableTerminationProtection(stackCtx, stack.StackName)
+				if err != nil {
+					UpdateNukeStats(dependencyTree)
+					msg = fmt.Sprintf("Unable to disable termination protection for stack '%v' Error: %v", sName, err)
+					stack.StackStatusReason = msg
+					notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
+					Logger.Error("Unable to disable termination protection for stack", LOG_STACK, sName, LOG_ERROR, err)
+					dependencyTree[sName] = stack
+					finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+					os.Exit(1)
+				}
+				stack.TerminationProtection = false
+				stack.TerminationProtectionDisabledAt = CurrentUTCDateTime()
+				dependencyTree[sName] = stack
+				writeToJSON(config.StackPattern, dependencyTree)
+				Logger.Warn("[Audit] Disabled termination protection for stack", LOG_STACK, sName, "audit", true)
+			}
+
+			stack, err := requestStackDeletion(stackCtx, stack, m, stackSets, accountID)
+			if errors.Is(err, ErrStackSetOperationInProgress) {
+				// stack is picked again in the next round
+				busyStackSets[stack.StackSetName] = true
+				dependencyTree[sName] = stack
+				Logger.Info("Stack queued until the running operation of its StackSet has finished", LOG_STACK, sName, "stack_set", stack.StackSetName)
+				continue
+			}
 			if err != nil {
 				UpdateNukeStats(dependencyTree)
 				msg = fmt.Sprintf("Unable to send delete request for stack '%v' Error: %v", sName, err)
 				stack.StackStatusReason = msg
 				notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
-				color.Error.Println(msg)
+				Logger.Error("Unable to send delete request for stack", LOG_STACK, sName, LOG_ATTEMPT, stack.DeleteAttempt+1, LOG_ERROR, err)
+				dependencyTree[sName] = stack
+				finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 				os.Exit(1)
 			}
 			stack.Status = models.DELETE_IN_PROGRESS
 			stack.DeleteStartedAt = CurrentUTCDateTime()
+			if stack.FirstDeleteStartedAt == "" {
+				stack.FirstDeleteStartedAt = stack.DeleteStartedAt
+			}
 			stack.DeleteAttempt = stack.DeleteAttempt + 1
+			if stack.StackSetName != "" {
+				busyStackSets[stack.StackSetName] = true
+			}
 			dependencyTree[sName] = stack
 			writeToJSON(config.StackPattern, dependencyTree)
+			Logger.Debug("Stack delete started", LOG_STACK, sName, LOG_ATTEMPT, stack.DeleteAttempt, LOG_STATUS, stack.Status)
+			runTrace.StackDeleteRequested(stack)
+			notifier.StackDeleteStartedAlert(AlertMessage{Stack: stack})
 		}
 
 		// 3. Wait for 30 seconds
-		fmt.Println("\n-----------------------------------------------------------------------------")
-		fmt.Printf("Waiting for %v seconds...\n", config.StackWaitTimeSeconds)
+		Logger.Info("Waiting for stacks to be deleted", "wait_seconds", config.StackWaitTimeSeconds)
 		time.Sleep(time.Duration(config.StackWaitTimeSeconds) * time.Second)
 
 		// 4. Get list of stacks in DELETE_IN_PROGRESS and describe stack
@@ -156,8 +380,31 @@ func InitiateTearDown(config models.Config) {
 		dipStacks := deleteInProgressStacks(dependencyTree)
 		for _, sName := range dipStacks {
 			stack := dependencyTree[sName]
+			m := managers[StackTarget(stack).Key()]
+
+			// stack instance is removed by the StackSet operation, the stack is left as is until the operation has finished
+			if stack.StackSetOperationId != "" {
+				opStatus, opReason, err := stackSets.OperationStatus(runTrace.Context(), stack.StackSetName, stack.StackSetOperationId, stackInstanceAccountID(stack, accountID), stack.Region)
+				if err != nil {
+					UpdateNukeStats(dependencyTree)
+					msg := fmt.Sprintf("Unable to describe StackSet operation of stack '%v'", sName)
+					stack.StackStatusReason = msg
+					notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
+					Logger.Error("Unable to describe StackSet operation of stack", LOG_STACK, sName, "stack_set", stack.StackSetName, "operation_id", stack.StackSetOperationId, LOG_ERROR, err)
+					dependencyTree[sName] = stack
+					finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+					os.Exit(1)
+				}
+				if OperationPending(opStatus) {
+					continue
+				}
+				if opReason != "" {
+					stack.StackStatusReason = opReason
+				}
+			}
+
 			// fetch latest stack details
-			details, err := cfn.DescribeStack(sName)
+			details, err := m.CFN.DescribeStack(runTrace.Context(), stack.StackName)
 
 			var dne bool
 			if err != nil {
@@ -169,7 +416,9 @@ func InitiateTearDown(config models.Config) {
 					msg := fmt.Sprintf("Unable to describe stack '%v'", sName)
 					stack.StackStatusReason = msg
 					notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
-					color.Error.Println(msg)
+					Logger.Error("Unable to describe stack", LOG_STACK, sName, LOG_ERROR, err)
+					dependencyTree[sName] = stack
+					finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 					os.Exit(1)
 				}
 			}
@@ -179,7 +428,7 @@ func InitiateTearDown(config models.Config) {
 			if dne {
 				newStatus = models.DELETE_COMPLETE
 			} else {
-				newStatus = *details.StackStatus
+				newStatus = string(details.StackStatus)
 			}
 
 			if newStatus == models.DELETE_IN_PROGRESS {
@@ -189,7 +438,7 @@ func InitiateTearDown(config models.Config) {
 				// update local copy
 				stack.Status = newStatus
 				stack.DeleteCompletedAt = CurrentUTCDateTime()
-				stack.DeletionTimeInMinutes = TimeDiff(stack.DeleteStartedAt, stack.DeleteCompletedAt)
+				stack.DeletionTimeInMinutes = stackDeletionMinutes(stack)
 
 				// updating stack details to dependency tree
 				dependencyTree[sName] = stack
@@ -197,33 +446,108 @@ func InitiateTearDown(config models.Config) {
 				// removing this stack from list of importers of all stacks and updating dependency tree
 				dependencyTree = updateImporterList(sName, dependencyTree)
 				writeToJSON(config.StackPattern, dependencyTree)
-				fmt.Printf("Stack successfully deleted: %v\n", sName)
+				Logger.Info("Stack successfully deleted", LOG_STACK, sName, LOG_ATTEMPT, stack.DeleteAttempt, LOG_STATUS, stack.Status, LOG_DURATION, LogDuration(stack.DeletionTimeInMinutes))
+				UpdateNukeStats(dependencyTree)
+				if stack.StackSetName != "" && config.DeleteEmptyStackSets {
+					// other stack instances of the StackSet might still be deleted later, so it is checked after removing each instance
+					deleted, err := stackSets.DeleteStackSetIfEmpty(runTrace.Context(), stack.StackSetName)
+					if err != nil {
+						Logger.Warn("Unable to delete empty StackSet", LOG_STACK, sName, "stack_set", stack.StackSetName, LOG_ERROR, err)
+					} else if deleted {
+						stack.StackSetDeletedAt = CurrentUTCDateTime()
+						dependencyTree[sName] = stack
+						writeToJSON(config.StackPattern, dependencyTree)
+						Logger.Warn("[Audit] Deleted empty StackSet", LOG_STACK, sName, "stack_set", stack.StackSetName, "audit", true)
+					}
+				}
+				observeStackDeletion(stack)
+				runTrace.StackDeleted(stack)
+				notifier.StackDeletedAlert(AlertMessage{Stack: stack})
+				progress.StackDeleted(stack)
 			} else {
+				// CloudFormation lets us delete a DELETE_FAILED stack by retaining the resources which failed to delete.
+				// This is attempted only once per stack and the retained resources are reported for manual cleanup.
+				// StackSet operations can't retain resources, so stacks managed by StackSets are left out.
+				if stack.DeleteAttempt >= config.MaxDeleteRetryCount && config.RetainFailedResources && newStatus == models.DELETE_FAILED && len(stack.RetainedResources) == 0 && stack.StackSetName == "" {
+					failedResources, err := m.CFN.ListFailedResources(runTrace.Context(), stack.StackName)
+					if err == nil && len(failedResources) > 0 {
+						logicalIds := []string{}
+						for _, r := range failedResources {
+							logicalIds = append(logicalIds, r.LogicalResourceId)
+						}
+
+						err = m.CFN.DeleteStackRetainingResources(runTrace.Context(), stack.StackName, logicalIds)
+						if err != nil {
+							UpdateNukeStats(dependencyTree)
+							msg = fmt.Sprintf("Unable to send delete request retaining resources for stack '%v' Error: %v", sName, err)
+							stack.StackStatusReason = msg
+							notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
+							Logger.Error("Unable to send delete request retaining resources for stack", LOG_STACK, sName, LOG_ERROR, err)
+							dependencyTree[sName] = stack
+							finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
+							os.Exit(1)
+						}
+						Logger.Warn("Retaining resources of stack for manual cleanup", LOG_STACK, sName, "retained_resources", strings.Join(logicalIds, ", "))
+
+						stack.RetainedResources = failedResources
+						stack.Status = models.DELETE_IN_PROGRESS
+						stack.DeleteStartedAt = CurrentUTCDateTime()
+						stack.DeleteAttempt = stack.DeleteAttempt + 1
+						dependencyTree[sName] = stack
+						writeToJSON(config.StackPattern, dependencyTree)
+						writeRetainedResourcesReport(dependencyTree)
+						runTrace.StackDeleteRequested(stack)
+						notifier.StackDeleteStartedAlert(AlertMessage{Stack: stack})
+						continue
+					}
+				}
+
 				if stack.DeleteAttempt >= config.MaxDeleteRetryCount {
 					stack.Status = newStatus
-					statusReason := *details.StackStatusReason
+					// stacks whose StackSet operation failed might not have a status reason as they were never deleted
+					statusReason := aws.ToString(details.StackStatusReason)
+					if statusReason == "" {
+						statusReason = stack.StackStatusReason
+					}
 					stack.StackStatusReason = statusReason
 
+					// stack status reason only lists failed resources, the actual reason lies in the stack events
+					failedResources, err := m.CFN.ListFailedResources(runTrace.Context(), stack.StackName)
+					if err == nil {
+						stack.FailedResources = failedResources
+					}
+
 					dependencyTree[sName] = stack
 					writeToJSON(config.StackPattern, dependencyTree)
 
 					UpdateNukeStats(dependencyTree)
 					msg := fmt.Sprintf("Failed to delete stack `%v`. Reason: %v", sName, statusReason)
 					notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
-					color.Error.Println(msg)
+					Logger.Error("Failed to delete stack", LOG_STACK, sName, LOG_ATTEMPT, stack.DeleteAttempt, LOG_STATUS, stack.Status, "reason", statusReason)
+					for _, r := range stack.FailedResources {
+						Logger.Error("  - "+r.LogicalResourceId, LOG_STACK, sName, "resource", r.LogicalResourceId, "resource_type", r.ResourceType, "physical_resource_id", r.PhysicalResourceId, "cause", r.Cause, "reason", r.StatusReason)
+					}
+					finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 					os.Exit(1)
 				} else {
 					// In some cases cloud9 stacks can't be deleted due to security group being manually attached to other resources like elastic search or redis
 					// In such case it is better to wait for dependent resource's(mostly datastore or cache) stack and security group to get deleted and retry again
 					newDeleteAttempt := stack.DeleteAttempt + 1
-					fmt.Printf("Retrying deleting stack: %v Delete Attempt: %v/%v\n", sName, newDeleteAttempt, config.MaxDeleteRetryCount)
-					err := cfn.DeleteStack(sName)
+					Logger.Warn("Retrying deleting stack", LOG_STACK, sName, LOG_ATTEMPT, newDeleteAttempt, "max_attempts", config.MaxDeleteRetryCount, LOG_STATUS, newStatus)
+					stack, err = requestStackDeletion(runTrace.Context(), stack, m, stackSets, accountID)
+					if errors.Is(err, ErrStackSetOperationInProgress) {
+						// stack is left in progress so that the retry is requested again in the next round
+						Logger.Info("Stack retry queued until the running operation of its StackSet has finished", LOG_STACK, sName, "stack_set", stack.StackSetName)
+						continue
+					}
 					if err != nil {
 						UpdateNukeStats(dependencyTree)
 						msg = fmt.Sprintf("Unable to send delete retry request for stack '%v' Error: %v", sName, err)
 						stack.StackStatusReason = msg
 						notifier.ErrorAlert(AlertMessage{Message: msg, FailedStack: stack})
-						color.Error.Println(msg)
+						Logger.Error("Unable to send delete retry request for stack", LOG_STACK, sName, LOG_ATTEMPT, newDeleteAttempt, LOG_ERROR, err)
+						dependencyTree[sName] = stack
+						finishTeardown(config, runTrace, dependencyTree, RUN_FAILED, msg, accountID)
 						os.Exit(1)
 					}
 					stack.Status = models.DELETE_IN_PROGRESS
@@ -231,6 +555,8 @@ func InitiateTearDown(config models.Config) {
 					stack.DeleteAttempt = newDeleteAttempt
 					dependencyTree[sName] = stack
 					writeToJSON(config.StackPattern, dependencyTree)
+					runTrace.StackDeleteRequested(stack)
+					notifier.StackDeleteStartedAlert(AlertMessage{Stack: stack})
 				}
 			}
 		}
@@ -238,24 +564,67 @@ func InitiateTearDown(config models.Config) {
 		// 5. If all stacks have already been deleted, stop execution. Else Go to step 1
 		if isEnvNuked(dependencyTree) {
 			UpdateNukeStats(dependencyTree)
-			color.Green.Printf("\n---------- STACK TEARDOWN SUCCESSFUL! STACKS DELETED: (%v) ----------\n\n", DELETED_STACK_COUNT)
+			Logger.Info("---------- STACK TEARDOWN SUCCESSFUL! ----------", "deleted_stack_count", DELETED_STACK_COUNT, LOG_DURATION, (time.Duration(NUKE_DURATION_IN_HRS * float64(time.Hour))).Round(time.Second).String())
 			notifier.SuccessAlert(AlertMessage{})
+			finishTeardown(config, runTrace, dependencyTree, RUN_SUCCEEDED, "", accountID)
 			break
 		}
 
-		// 6. Check if nuke is stuck
+		// 6. Send progress alert if it's due
+		if progress.Due(time.Now()) {
+			UpdateNukeStats(dependencyTree)
+			notifier.ProgressAlert(AlertMessage{Progress: progress.Flush(time.Now(), ACTIVE_STACK_COUNT)})
+		}
+
+		// 7. Check if nuke is stuck
 		if isNukeStuck(dependencyTree) {
 			UpdateNukeStats(dependencyTree)
 			// TODO: better messaging
 			msg := "No stacks are eligible for deletion. Please find and delete stacks which do not have follow given pattern: " + config.StackPattern
 			notifier.StuckAlert(AlertMessage{Message: msg})
-			color.Error.Println(msg)
+			Logger.Error(msg, "active_stack_count", ACTIVE_STACK_COUNT)
+			finishTeardown(config, runTrace, dependencyTree, RUN_STUCK, msg, accountID)
 			os.Exit(1)
 			break
 		}
 	}
 }
 
+// finishTeardown exports traces, pushes final metrics and writes the run report in configured formats once the teardown has ended
+func finishTeardown(config models.Config, runTrace *RunTrace, dt map[string]models.StackDetails, status, message, accountID string) {
+	UpdateNukeStats(dt)
+	runTrace.End(dt, status, message)
+	SetRunStatus(status)
+	if config.PushgatewayURL != "" {
+		if err := PushMetrics(config.PushgatewayURL, config.PushgatewayJob, config.StackPattern); err != nil {
+			Logger.Error("Unable to push metrics to Pushgateway", LOG_ERROR, err)
+		}
+	}
+
+	formats, _ := ParseReportFormats(config.ReportFormats)
+	if len(formats) == 0 {
+		return
+	}
+	report := NewReport(dt, status, message, config.StackPattern, accountID, config.AWSRegions)
+	if err := WriteReports(report, formats, config.ReportDir); err != nil {
+		Logger.Error("Unable to write report", LOG_ERROR, err)
+	}
+}
+
+// printPlan shows order of deletion and blockers found in dry run
+func printPlan(plan PlanDetails) {
+	Logger.Info("Order of deletion:")
+	for i, wave := range plan.Waves {
+		Logger.Info(fmt.Sprintf(" %v. %v", i+1, strings.Join(wave, ", ")), "wave", i+1, "stacks", strings.Join(wave, ", "))
+	}
+	if len(plan.OutsidePattern) > 0 {
+		Logger.Warn("Stacks not matching the pattern but importing from matching stacks", "stacks", strings.Join(plan.OutsidePattern, ", "))
+	}
+	for _, blocker := range plan.Blockers {
+		Logger.Warn("Blocker: "+blocker, "blocker", blocker)
+	}
+}
+
 // When a stack is deleted, we can safely remove it from list of importers
 // so that the parent stack is free of dependencies and becomes eligible for deletion in the next cycle.
 func updateImporterList(deletedStackName string, dt map[string]models.StackDetails) map[string]models.StackDetails {
@@ -267,29 +636,84 @@ func updateImporterList(deletedStackName string, dt map[string]models.StackDetai
 	return dt
 }
 
-// In order to a stack with S3 bucket, we need to empty it first which is done by this method.
-func deleteBucketIfPresent(stackName string, cfn CFNManager, s3 S3Manager) error {
-	resources, _ := cfn.ListStackResources(stackName)
+// requestStackDeletion sends delete request for the stack. Stacks managed by StackSets are deleted by removing their stack instance
+// from the StackSet in the administrator account and the id of the StackSet operation is recorded in the stack details.
+func requestStackDeletion(ctx context.Context, stack models.StackDetails, m TargetManagers, stackSets StackSetManager, accountID string) (models.StackDetails, error) {
+	if stack.StackSetName == "" {
+		return stack, m.CFN.DeleteStack(ctx, stack.StackName)
+	}
 
-	var objDeleteError error
+	instanceAccountID := stackInstanceAccountID(stack, accountID)
+	if instanceAccountID == "" {
+		return stack, fmt.Errorf("Unable to find account id of stack instance of StackSet '%v'", stack.StackSetName)
+	}
+	operationID, err := stackSets.DeleteStackInstance(ctx, stack.StackSetName, instanceAccountID, stack.Region)
+	if err != nil {
+		return stack, err
+	}
+	stack.StackSetOperationId = operationID
+	return stack, nil
+}
+
+// stackInstanceAccountID returns account of the stack i.e. account listed in the manifest or the account of the aws profile or ROLE_ARN.
+func stackInstanceAccountID(stack models.StackDetails, accountID string) string {
+	if stack.AccountID != "" {
+		return stack.AccountID
+	}
+	return accountID
+}
+
+// Some resources can't be deleted by cloudformation unless they are empty e.g. S3 buckets, ECR repositories and Route53 hosted zones.
+// This method empties such resources owned by the stack and records what was removed in the stack details.
+func emptyResourcesIfPresent(ctx context.Context, stack models.StackDetails, m TargetManagers) (models.StackDetails, error) {
+	stackName := stack.StackName
+	resources, err := m.CFN.ListStackResources(ctx, stackName)
+	if err != nil {
+		return stack, fmt.Errorf("Unable to list resources of stack '%v': %v", stackName, err)
+	}
+
+	var emptyError error
 	for _, resource := range resources {
 		// if a stack is in ROLLBACK_COMPLETE state. Some of the resources might not have physical resource ID
-		// so checking this first. If there is no resource. No need to empty the bucket
-		if resource.PhysicalResourceId != nil && resource.ResourceType != nil {
-			rType := *resource.ResourceType
-			rName := *resource.PhysicalResourceId
+		// so checking this first. If there is no resource. No need to empty it
+		if resource.PhysicalResourceId == nil || resource.ResourceType == nil {
+			continue
+		}
+		rType := *resource.ResourceType
+		rName := *resource.PhysicalResourceId
+
+		switch rType {
+		case "AWS::S3::Bucket":
 			// bucket should be empty before we delete the cfn stack, thus emptying bucket here
-			if rType == "AWS::S3::Bucket" {
-				objDeleteError = s3.EmptyBucket(rName)
-				if objDeleteError != nil {
-					msg := fmt.Sprintf("Failed to empty bucket '%v' from stack '%v'. Error: %v", rName, stackName, objDeleteError.Error())
-					fmt.Println(msg)
-					break
-				}
+			_, span := Tracer.Start(ctx, "EmptyBucket", trace.WithAttributes(attribute.String("bucket", rName)))
+			emptyError = m.S3.EmptyBucket(ctx, rName)
+			endSpan(span, emptyError)
+			if emptyError != nil {
+				Logger.Error("Failed to empty bucket", "bucket", rName, LOG_STACK, stackName, LOG_ERROR, emptyError)
+			}
+		case "AWS::ECR::Repository":
+			// repository with images can't be deleted, thus deleting all images here
+			var deletedImages int
+			deletedImages, emptyError = m.ECR.PurgeRepository(ctx, rName)
+			stack.ECRImagesDeleted += deletedImages
+			if emptyError != nil {
+				Logger.Error("Failed to purge repository", "repository", rName, LOG_STACK, stackName, LOG_ERROR, emptyError)
 			}
+		case "AWS::Route53::HostedZone":
+			// hosted zone can't be deleted while it has records other than SOA and NS e.g. records created by external-dns or ACM validation
+			var deletedRecords []string
+			deletedRecords, emptyError = m.R53.EmptyHostedZone(ctx, rName)
+			stack.Route53RecordsDeleted = append(stack.Route53RecordsDeleted, deletedRecords...)
+			if emptyError != nil {
+				Logger.Error("Failed to delete records from hosted zone", "hosted_zone", rName, LOG_STACK, stackName, LOG_ERROR, emptyError)
+			}
+		}
+
+		if emptyError != nil {
+			break
 		}
 	}
-	return objDeleteError
+	return stack, emptyError
 }
 
 // In some cases, there could be no stacks which are eligible for deletion. This can happen due to cyclic dependency. In such case, we abort nuke and notify the user for manual intervention.
@@ -314,6 +738,17 @@ func stacksEligibleToDelete(dt map[string]models.StackDetails) []string {
 	return deleteReady
 }
 
+// stackSetsWithRunningOperations lists StackSets which are removing a stack instance of the teardown
+func stackSetsWithRunningOperations(dt map[string]models.StackDetails) map[string]bool {
+	busy := map[string]bool{}
+	for _, stackDetails := range dt {
+		if stackDetails.StackSetName != "" && stackDetails.StackSetOperationId != "" && stackDetails.Status == models.DELETE_IN_PROGRESS {
+			busy[stackDetails.StackSetName] = true
+		}
+	}
+	return busy
+}
+
 func deleteInProgressStacks(dt map[string]models.StackDetails) []string {
 	dip := []string{}
 	for stackName, stackDetails := range dt {
@@ -336,32 +771,78 @@ func isEnvNuked(dt map[string]models.StackDetails) bool {
 	return nuked
 }
 
+// discoverStacks prepares dependency tree of every target and combines them into a single tree keyed by target and stack name.
+// Dependencies which can't be found via imports i.e. region ordering constraints, declared and SSM derived dependencies are added on top.
+func discoverStacks(ctx context.Context, config models.Config, targets []Target, regionOrder []RegionOrder, stackDependencies []StackDependency, managers map[string]TargetManagers) (map[string]models.StackDetails, error) {
+	dependencyTree := map[string]models.StackDetails{}
+	for _, target := range targets {
+		m := managers[target.Key()]
+		if err := ValidateTarget(ctx, target, m); err != nil {
+			return dependencyTree, err
+		}
+		dt, err := prepareDependencyTree(ctx, config.StackPattern, target, m.CFN)
+		for key, stack := range dt {
+			dependencyTree[key] = stack
+		}
+		if err != nil {
+			return dependencyTree, err
+		}
+	}
+
+	if config.SSMDependencies {
+		Logger.Info("Finding dependencies via SSM parameters...")
+		_, span := Tracer.Start(ctx, "DiscoverSSMDependencies")
+		ssmDependencies, err := DiscoverSSMDependencies(ctx, dependencyTree, managers)
+		endSpan(span, err)
+		if err != nil {
+			return dependencyTree, err
+		}
+		stackDependencies = append(stackDependencies, ssmDependencies...)
+	}
+	dependencyTree = AddStackDependencyEdges(dependencyTree, stackDependencies)
+	return AddRegionOrderEdges(dependencyTree, regionOrder), nil
+}
+
 // prepareDependencyTree generates list of stacks and their dependencies which is useful to determine the order of deletion
-func prepareDependencyTree(envLabel string, cfn CFNManager) (map[string]models.StackDetails, error) {
+func prepareDependencyTree(ctx context.Context, envLabel string, target Target, cfn CFNManager) (dependencyTree map[string]models.StackDetails, err error) {
+	ctx, span := Tracer.Start(ctx, "PrepareDependencyTree", trace.WithAttributes(attribute.String("cloud.region", target.Region), attribute.String("cloud.account.id", target.AccountID)))
+	defer func() { endSpan(span, err) }()
+
 	CFNConsoleBaseURL := "https://console.aws.amazon.com/cloudformation/home?region=" + cfn.AWSRegion + "#/stacks/stackinfo?stackId="
 
-	fmt.Printf("-------------- Listing Stacks | Match Pattern: [%v] --------------\n", color.Gray.Render(envLabel))
+	Logger.Info("-------------- Listing Stacks --------------", "stack_pattern", envLabel, "target", target.Key())
+	dependencyTree = map[string]models.StackDetails{}
 
-	dependencyTree, err := cfn.ListEnvironmentStacks()
+	_, listSpan := Tracer.Start(ctx, "ListEnvironmentStacks")
+	stacks, err := cfn.ListEnvironmentStacks(ctx)
+	listSpan.SetAttributes(attribute.Int("stack_count", len(stacks)))
+	endSpan(listSpan, err)
+	for stackName, stack := range stacks {
+		stack.AccountID = target.AccountID
+		dependencyTree[target.StackKey(stackName)] = stack
+	}
 	totalStackCount := len(dependencyTree)
 
 	if err != nil {
 		UpdateNukeStats(dependencyTree)
-		color.Error.Printf("  Failed listing stacks! Error: %v\n", err)
+		Logger.Error("Failed listing stacks!", LOG_ERROR, err)
 		return dependencyTree, err
 	}
 
-	color.Gray.Println("  Listing all exports...")
-	stackExports, err := cfn.ListEnvironmentExports()
+	Logger.Info("Listing all exports...")
+	_, exportsSpan := Tracer.Start(ctx, "ListEnvironmentExports")
+	stackExports, err := cfn.ListEnvironmentExports(ctx)
+	endSpan(exportsSpan, err)
 	if err != nil {
-		color.Error.Printf("  Failed listing exports! Error: %v", err)
+		Logger.Error("Failed listing exports!", LOG_ERROR, err)
 		return dependencyTree, err
 	}
 
-	color.Gray.Println("  Listing all imports...")
+	Logger.Info("Listing all imports...")
 	stackCount := 0
 	var listImportErr error
-	for stackName, stack := range dependencyTree {
+	for key, stack := range dependencyTree {
+		stackName := stack.StackName
 		// populate exports
 		if _, ok := stackExports[stackName]; ok {
 			if len(stackExports[stackName]) > 0 {
@@ -369,17 +850,30 @@ func prepareDependencyTree(envLabel string, cfn CFNManager) (map[string]models.S
 			}
 		}
 
+		// termination protection is not part of the stack summary, so describing each stack
+		sDetails, err := cfn.DescribeStack(ctx, stackName)
+		if err != nil {
+			Logger.Error("Failed describing stack!", LOG_STACK, stackName, LOG_ERROR, err)
+			return dependencyTree, err
+		}
+		stack.TerminationProtection = aws.ToBool(sDetails.EnableTerminationProtection)
+		stack.StackSetName = StackSetName(stackName)
+		stack.ServiceRoleARN = aws.ToString(sDetails.RoleARN)
+
 		// listing all importers. making single api call at a time to avoid rate limiting
-		importingStacks, listImportErr := cfn.ListImports(stack.Exports)
+		_, importsSpan := Tracer.Start(ctx, "ListImports", trace.WithAttributes(attribute.String(LOG_STACK, stackName), attribute.Int("export_count", len(stack.Exports))))
+		importingStacks, listImportErr := cfn.ListImports(ctx, stack.Exports)
+		endSpan(importsSpan, listImportErr)
 		if listImportErr != nil {
-			color.Error.Printf("  Failed listing imports! Error: %v", listImportErr)
+			Logger.Error("Failed listing imports!", LOG_STACK, stackName, LOG_ERROR, listImportErr)
 			break
 		}
 
-		stack.ActiveImporterStacks = importingStacks
-		dependencyTree[stackName] = stack
+		// imports are region local
+		stack.ActiveImporterStacks = targetStackKeys(target, importingStacks)
+		dependencyTree[key] = stack
 		stackCount++
-		color.Gray.Println("  Listing imports | ", stackCount, "/", totalStackCount, " stacks complete")
+		Logger.Info("Listing imports", LOG_STACK, stackName, "complete", stackCount, "total", totalStackCount)
 	}
 
 	if listImportErr != nil {
@@ -393,17 +887,20 @@ func prepareDependencyTree(envLabel string, cfn CFNManager) (map[string]models.S
 		// TODO: better logging for this. include this in readme as well
 		// fmt.Printf("Stack '%v' does not match pattern '%v' and imports from stacks selected for deletion", missing, cfn.EnvLabel)
 		// fmt.Printf("Included '%v' stack in the deletion list", missing)
-		for mStk := range missing {
+		for mKey := range missing {
 			totalStackCount++
-			sDetails, err := cfn.DescribeStack(mStk)
+			mStk := stackNameFromKey(mKey)
+			sDetails, err := cfn.DescribeStack(ctx, mStk)
 			if err != nil {
 				dne := strings.Contains(err.Error(), "does not exist")
 				if !dne {
-					color.Error.Printf("  Error describing stack %v", mStk)
+					Logger.Error("Error describing stack", LOG_STACK, mStk, LOG_ERROR, err)
 					break // real error.
 				}
-				dependencyTree[mStk] = models.StackDetails{
+				dependencyTree[mKey] = models.StackDetails{
 					StackName:      mStk,
+					Region:         target.Region,
+					AccountID:      target.AccountID,
 					Status:         "DELETE_COMPLETE",
 					CFNConsoleLink: (CFNConsoleBaseURL + mStk),
 				}
@@ -415,18 +912,25 @@ func prepareDependencyTree(envLabel string, cfn CFNManager) (map[string]models.S
 				}
 
 				// list imports
-				importingStacks, listImportErr := cfn.ListImports(exports)
+				_, importsSpan := Tracer.Start(ctx, "ListImports", trace.WithAttributes(attribute.String(LOG_STACK, mStk), attribute.Int("export_count", len(exports))))
+				importingStacks, listImportErr := cfn.ListImports(ctx, exports)
+				endSpan(importsSpan, listImportErr)
 				if listImportErr != nil {
-					color.Error.Println("  Failed listing imports!")
+					Logger.Error("Failed listing imports!", LOG_STACK, mStk, LOG_ERROR, listImportErr)
 					break
 				}
 
-				dependencyTree[mStk] = models.StackDetails{
-					StackName:            mStk,
-					Status:               *sDetails.StackStatus,
-					Exports:              exports,
-					ActiveImporterStacks: importingStacks,
-					CFNConsoleLink:       (CFNConsoleBaseURL + mStk),
+				dependencyTree[mKey] = models.StackDetails{
+					StackName:             mStk,
+					Region:                target.Region,
+					AccountID:             target.AccountID,
+					Status:                string(sDetails.StackStatus),
+					Exports:               exports,
+					ActiveImporterStacks:  targetStackKeys(target, importingStacks),
+					CFNConsoleLink:        (CFNConsoleBaseURL + mStk),
+					TerminationProtection: aws.ToBool(sDetails.EnableTerminationProtection),
+					StackSetName:          StackSetName(mStk),
+					ServiceRoleARN:        aws.ToString(sDetails.RoleARN),
 				}
 			}
 		}
@@ -438,6 +942,15 @@ func prepareDependencyTree(envLabel string, cfn CFNManager) (map[string]models.S
 
 // --------------------- Utility functions ---------------------------
 
+// targetStackKeys converts names of stacks in the target to stack keys
+func targetStackKeys(target Target, stackNames map[string]struct{}) map[string]struct{} {
+	keys := map[string]struct{}{}
+	for stackName := range stackNames {
+		keys[target.StackKey(stackName)] = struct{}{}
+	}
+	return keys
+}
+
 func getStackWithMissingDependencies(dt map[string]models.StackDetails) map[string]struct{} {
 	allImporterStacks := map[string]struct{}{}
 	notListed := map[string]struct{}{}
@@ -459,10 +972,63 @@ func getStackWithMissingDependencies(dt map[string]models.StackDetails) map[stri
 }
 
 func writeToJSON(envLabel string, data map[string]models.StackDetails) {
-	file, _ := json.MarshalIndent(data, "", " ")
+	file, _ := json.MarshalIndent(fileStacks(data), "", " ")
 	_ = ioutil.WriteFile("stack_teardown_details.json", file, 0644)
 }
 
+// fileStacks keys stacks by their name in the files written by the teardown as long as all of them belong to a single target,
+// so that the files keep their format for single region runs. Stacks of multiple targets are keyed by their stack key
+// e.g. 'us-east-1/qa-vpc' as names can repeat across regions and accounts.
+func fileStacks(data map[string]models.StackDetails) map[string]models.StackDetails {
+	targets := map[string]struct{}{}
+	for _, stack := range data {
+		targets[StackTarget(stack).Key()] = struct{}{}
+	}
+	if len(targets) > 1 {
+		return data
+	}
+	stacks := make(map[string]models.StackDetails, len(data))
+	for _, stack := range data {
+		// imports are region local, so importers belong to the same target as well
+		importers := make(map[string]struct{}, len(stack.ActiveImporterStacks))
+		for key := range stack.ActiveImporterStacks {
+			importers[stackNameFromKey(key)] = struct{}{}
+		}
+		stack.ActiveImporterStacks = importers
+		stacks[stack.StackName] = stack
+	}
+	return stacks
+}
+
+// RetainedResourcesReport lists resources left behind by a stack which was deleted while retaining failed resources.
+type RetainedResourcesReport struct {
+	StackName         string
+	CFNConsoleLink    string
+	RetainedResources []models.FailedResource
+}
+
+// writeRetainedResourcesReport writes resources retained during teardown to a separate file
+// so that they can be found and cleaned up later.
+func writeRetainedResourcesReport(data map[string]models.StackDetails) {
+	report := []RetainedResourcesReport{}
+	for stackName, stack := range fileStacks(data) {
+		if len(stack.RetainedResources) > 0 {
+			report = append(report, RetainedResourcesReport{StackName: stackName, CFNConsoleLink: stack.CFNConsoleLink, RetainedResources: stack.RetainedResources})
+		}
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].StackName < report[j].StackName })
+
+	file, _ := json.MarshalIndent(report, "", " ")
+	_ = ioutil.WriteFile("retained_resources.json", file, 0644)
+}
+
+// NewRunID generates id for a teardown run from its start time and a random suffix e.g. 20210207T033054Z-3f9a
+func NewRunID() string {
+	suffix := make([]byte, 2)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%v-%x", time.Now().UTC().Format("20060102T150405Z"), suffix)
+}
+
 // CurrentUTCDateTime returns current time in ISO string
 func CurrentUTCDateTime() string {
 	return time.Now().UTC().Format("2006-01-02T15:04:05Z")
@@ -476,6 +1042,15 @@ func TimeDiff(startTime, endTime string) string {
 	return fmt.Sprintf("%.2f", diff.Minutes())
 }
 
+// stackDeletionMinutes returns minutes taken to delete the stack counted from its first delete request, so that retries are included.
+func stackDeletionMinutes(stack models.StackDetails) string {
+	startedAt := stack.FirstDeleteStartedAt
+	if startedAt == "" {
+		startedAt = stack.DeleteStartedAt
+	}
+	return TimeDiff(startedAt, stack.DeleteCompletedAt)
+}
+
 // UpdateNukeStats updates global variables used for capturing teardown stats
 func UpdateNukeStats(dt map[string]models.StackDetails) {
 	NUKE_END_TIME = CurrentUTCDateTime()
@@ -491,4 +1066,5 @@ func UpdateNukeStats(dt map[string]models.StackDetails) {
 	}
 	DELETED_STACK_COUNT = deletedStackCount
 	ACTIVE_STACK_COUNT = TOTAL_STACK_COUNT - DELETED_STACK_COUNT
+	updateStackMetrics(dt)
 }
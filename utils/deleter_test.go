@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func TestFileStacksUseStackNamesForSingleTarget(t *testing.T) {
+	dt := map[string]models.StackDetails{
+		"us-east-1/qa-vpc": {StackName: "qa-vpc", Region: "us-east-1", ActiveImporterStacks: map[string]struct{}{"us-east-1/qa-app": {}}},
+		"us-east-1/qa-app": {StackName: "qa-app", Region: "us-east-1", ActiveImporterStacks: map[string]struct{}{}},
+	}
+
+	stacks := fileStacks(dt)
+	if len(stacks) != 2 {
+		t.Fatalf("expected 2 stacks, got %v", len(stacks))
+	}
+	vpc, ok := stacks["qa-vpc"]
+	if !ok {
+		t.Fatalf("expected stacks to be keyed by name, got %v", stacks)
+	}
+	if _, ok := vpc.ActiveImporterStacks["qa-app"]; !ok || len(vpc.ActiveImporterStacks) != 1 {
+		t.Errorf("expected importers to be keyed by name, got %v", vpc.ActiveImporterStacks)
+	}
+	// dependency tree itself is left untouched
+	if _, ok := dt["us-east-1/qa-vpc"].ActiveImporterStacks["us-east-1/qa-app"]; !ok {
+		t.Errorf("expected dependency tree importers to keep their stack keys, got %v", dt["us-east-1/qa-vpc"].ActiveImporterStacks)
+	}
+}
+
+func TestFileStacksUseStackKeysForMultipleTargets(t *testing.T) {
+	dt := map[string]models.StackDetails{
+		"us-east-1/qa-vpc":              {StackName: "qa-vpc", Region: "us-east-1"},
+		"111111111111/us-east-1/qa-vpc": {StackName: "qa-vpc", Region: "us-east-1", AccountID: "111111111111"},
+	}
+
+	stacks := fileStacks(dt)
+	for key := range dt {
+		if _, ok := stacks[key]; !ok {
+			t.Errorf("expected stack key %v to be kept, got %v", key, stacks)
+		}
+	}
+}
+
+func TestStackSetsWithRunningOperations(t *testing.T) {
+	dt := map[string]models.StackDetails{
+		// instance removal requested in an earlier round
+		"111111111111/us-east-1/StackSet-qa-roles-1": {StackName: "StackSet-qa-roles-1", StackSetName: "qa-roles", StackSetOperationId: "op-1", Status: models.DELETE_IN_PROGRESS},
+		"222222222222/us-east-1/StackSet-qa-roles-2": {StackName: "StackSet-qa-roles-2", StackSetName: "qa-roles", Status: "CREATE_COMPLETE"},
+		// operation of a removed instance has finished
+		"111111111111/us-east-1/StackSet-qa-logs-1": {StackName: "StackSet-qa-logs-1", StackSetName: "qa-logs", StackSetOperationId: "op-2", Status: models.DELETE_COMPLETE},
+		// instance removal failed and is retried
+		"111111111111/us-east-1/StackSet-qa-dns-1": {StackName: "StackSet-qa-dns-1", StackSetName: "qa-dns", StackSetOperationId: "op-3", Status: models.DELETE_FAILED},
+		"111111111111/us-east-1/qa-app":            {StackName: "qa-app", Status: models.DELETE_IN_PROGRESS},
+	}
+
+	busy := stackSetsWithRunningOperations(dt)
+	if expected := map[string]bool{"qa-roles": true}; !reflect.DeepEqual(busy, expected) {
+		t.Errorf("expected busy StackSets %v, got %v", expected, busy)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// Sources of dependencies which are not found via imports
+const (
+	DECLARED_DEPENDENCY = "declared"
+	SSM_DEPENDENCY      = "ssm:"
+)
+
+// StackDependency means that the consumer stack depends on the producer stack, so the consumer is deleted first.
+// Stacks are referred by their keys e.g. 'eu-west-1/qa-cdn'.
+type StackDependency struct {
+	Consumer string
+	Producer string
+	Source   string // 'declared' or 'ssm:<parameter name>'
+}
+
+// ParseStackDependencies parses comma separated dependencies e.g. 'eu-west-1/qa-cdn>us-east-1/qa-certs' which deletes qa-cdn in eu-west-1 before qa-certs in us-east-1.
+func ParseStackDependencies(value string) ([]StackDependency, error) {
+	deps := []StackDependency{}
+	for _, dep := range strings.Split(value, ",") {
+		if strings.TrimSpace(dep) == "" {
+			continue
+		}
+		consumer, producer, found := strings.Cut(dep, ">")
+		consumer, producer = strings.TrimSpace(consumer), strings.TrimSpace(producer)
+		if !found || !strings.Contains(consumer, "/") || !strings.Contains(producer, "/") || strings.Contains(producer, ">") {
+			return nil, fmt.Errorf("Invalid stack dependency '%v'. Expected format: 'eu-west-1/qa-cdn>us-east-1/qa-certs'", dep)
+		}
+		deps = append(deps, StackDependency{Consumer: consumer, Producer: producer, Source: DECLARED_DEPENDENCY})
+	}
+	return deps, nil
+}
+
+// AddStackDependencyEdges adds consumers as importers of their producers so that the consumers are deleted first.
+// Dependencies with stacks which are not in the dependency tree are skipped as there is nothing to wait for.
+func AddStackDependencyEdges(dt map[string]models.StackDetails, deps []StackDependency) map[string]models.StackDetails {
+	for _, dep := range deps {
+		producer, ok := dt[dep.Producer]
+		if !ok {
+			Logger.Warn("Skipping dependency as producer stack is not selected for deletion", "consumer", dep.Consumer, "producer", dep.Producer, "source", dep.Source)
+			continue
+		}
+		consumer, ok := dt[dep.Consumer]
+		if !ok {
+			Logger.Warn("Skipping dependency as consumer stack is not selected for deletion", "consumer", dep.Consumer, "producer", dep.Producer, "source", dep.Source)
+			continue
+		}
+		if dep.Consumer == dep.Producer || consumer.Status == models.DELETE_COMPLETE {
+			continue
+		}
+
+		if producer.ActiveImporterStacks == nil {
+			producer.ActiveImporterStacks = map[string]struct{}{}
+		}
+		if producer.ExternalImporterStacks == nil {
+			producer.ExternalImporterStacks = map[string]string{}
+		}
+		producer.ActiveImporterStacks[dep.Consumer] = struct{}{}
+		producer.ExternalImporterStacks[dep.Consumer] = dep.Source
+		dt[dep.Producer] = producer
+		Logger.Debug("Added dependency", "consumer", dep.Consumer, "producer", dep.Producer, "source", dep.Source)
+	}
+	return dt
+}
+
+// DiscoverSSMDependencies finds stacks which read SSM parameters created by other stacks, usually in other regions via
+// replication or custom resources which CloudFormation doesn't track as imports.
+// Producers are stacks with 'AWS::SSM::Parameter' resources and consumers are stacks referring to those parameter names
+// in their template e.g. '{{resolve:ssm:/qa/cert-arn}}' or in their parameter values.
+func DiscoverSSMDependencies(ctx context.Context, dt map[string]models.StackDetails, managers map[string]TargetManagers) ([]StackDependency, error) {
+	// parameter name -> stack keys creating it, the same parameter can exist in multiple regions
+	producers := map[string][]string{}
+	for key, stack := range dt {
+		if stack.Status == models.DELETE_COMPLETE {
+			continue
+		}
+		resources, err := managers[StackTarget(stack).Key()].CFN.ListStackResources(ctx, stack.StackName)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list resources of stack '%v': %v", key, err)
+		}
+		for _, r := range resources {
+			if r.ResourceType != nil && *r.ResourceType == "AWS::SSM::Parameter" && r.PhysicalResourceId != nil {
+				producers[*r.PhysicalResourceId] = append(producers[*r.PhysicalResourceId], key)
+			}
+		}
+	}
+	if len(producers) == 0 {
+		return nil, nil
+	}
+
+	deps := []StackDependency{}
+	for key, stack := range dt {
+		if stack.Status == models.DELETE_COMPLETE {
+			continue
+		}
+		cfn := managers[StackTarget(stack).Key()].CFN
+		body, err := cfn.GetTemplateBody(ctx, stack.StackName)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get template of stack '%v': %v", key, err)
+		}
+		details, err := cfn.DescribeStack(ctx, stack.StackName)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to describe stack '%v': %v", key, err)
+		}
+		references := []string{body}
+		for _, p := range details.Parameters {
+			if p.ParameterValue != nil {
+				references = append(references, *p.ParameterValue)
+			}
+		}
+
+		for name, producerKeys := range producers {
+			if !referencesParameter(references, name) {
+				continue
+			}
+			for _, producer := range producerKeys {
+				if producer != key {
+					deps = append(deps, StackDependency{Consumer: key, Producer: producer, Source: SSM_DEPENDENCY + name})
+				}
+			}
+		}
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Producer != deps[j].Producer {
+			return deps[i].Producer < deps[j].Producer
+		}
+		return deps[i].Consumer < deps[j].Consumer
+	})
+	return deps, nil
+}
+
+// referencesParameter checks whether the parameter name appears in any of the values as a whole name
+// i.e. '/qa/cert' is not referenced by '/qa/cert-arn'.
+func referencesParameter(values []string, name string) bool {
+	for _, value := range values {
+		for i := strings.Index(value, name); i >= 0; {
+			end := i + len(name)
+			if (i == 0 || !isParameterNameChar(value[i-1])) && (end == len(value) || !isParameterNameChar(value[end])) {
+				return true
+			}
+			next := strings.Index(value[i+1:], name)
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+	return false
+}
+
+// isParameterNameChar reports whether the character can be part of a SSM parameter name
+func isParameterNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_.-/", c) >= 0
+}
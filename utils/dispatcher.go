@@ -0,0 +1,240 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NotificationDispatcher delivers notification payloads over http.
+// Requests are retried with exponential backoff on network errors, 429 and 5xx responses honouring 'Retry-After' header.
+// Payloads which could not be delivered after all attempts are appended to a dead letter file so that alerts are not lost silently.
+type NotificationDispatcher struct {
+	Client         *http.Client
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	MaxRetryAfter  time.Duration // 'Retry-After' beyond this is capped so that a misbehaving backend can't stall the teardown
+	MaxRetryTime   time.Duration // total wait between attempts of a single message as delivery blocks the deletion loop
+	DeadLetterFile string        // skipped if empty
+
+	mu sync.Mutex // guards writes to dead letter file
+}
+
+// DeadLetter is a notification which could not be delivered. One json object is written per line.
+type DeadLetter struct {
+	Timestamp string          `json:"timestamp"`
+	RunID     string          `json:"run_id"`
+	Backend   string          `json:"backend"`
+	Endpoint  string          `json:"endpoint"` // only scheme and host as webhook urls contain secrets, smtp server for emails
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// NewNotificationDispatcher creates dispatcher with the given request timeout and max delivery attempts.
+func NewNotificationDispatcher(timeout time.Duration, maxAttempts int, deadLetterFile string) *NotificationDispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &NotificationDispatcher{
+		Client:         &http.Client{Timeout: timeout},
+		MaxAttempts:    maxAttempts,
+		BaseBackoff:    time.Second,
+		MaxBackoff:     30 * time.Second,
+		MaxRetryAfter:  5 * time.Second,
+		MaxRetryTime:   10 * time.Second,
+		DeadLetterFile: deadLetterFile,
+	}
+}
+
+// PostJSON posts the message as json and returns the response body. Any non 2xx response is treated as failure.
+func (nd *NotificationDispatcher) PostJSON(backend, endpoint string, msgBody interface{}, headers map[string]string) ([]byte, error) {
+	postBody, err := json.Marshal(msgBody)
+	if err != nil {
+		Logger.Error("Error marshaling notification request body", "backend", backend, LOG_ERROR, err)
+		return nil, err
+	}
+
+	var body []byte
+	err = nd.Deliver(backend, endpoint, postBody, func() (time.Duration, bool, error) {
+		var retryAfter time.Duration
+		var retryable bool
+		var err error
+		body, retryAfter, retryable, err = nd.post(endpoint, postBody, headers)
+		return retryAfter, retryable, err
+	})
+	return body, err
+}
+
+// Deliver makes delivery attempts until one succeeds, the failure is not retryable or max attempts are exhausted.
+// The attempt reports how long the backend asked to wait before retrying and whether the failure is worth retrying.
+// Waits between attempts add up to MaxRetryTime at most, so that a throttling backend can't hold up the teardown.
+// Payload is written to the dead letter file if the message could not be delivered.
+func (nd *NotificationDispatcher) Deliver(backend, endpoint string, payload []byte, attemptDelivery func() (retryAfter time.Duration, retryable bool, err error)) error {
+	var err error
+	var waited time.Duration
+	attempt := 0
+	for {
+		attempt++
+		var retryAfter time.Duration
+		var retryable bool
+		retryAfter, retryable, err = attemptDelivery()
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= nd.MaxAttempts {
+			break
+		}
+
+		wait := nd.backoff(attempt)
+		if retryAfter > nd.MaxRetryAfter {
+			retryAfter = nd.MaxRetryAfter
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if remaining := nd.MaxRetryTime - waited; wait > remaining {
+			if remaining <= 0 {
+				break
+			}
+			wait = remaining
+		}
+		waited += wait
+		Logger.Warn("Failed to deliver notification, retrying", "backend", backend, LOG_ERROR, err, "retry_in", wait.String(), LOG_ATTEMPT, attempt+1, "max_attempts", nd.MaxAttempts)
+		time.Sleep(wait)
+	}
+
+	Logger.Error("Giving up delivering notification", "backend", backend, LOG_ATTEMPT, attempt, LOG_ERROR, err)
+	nd.deadLetter(backend, endpoint, attempt, err, payload)
+	return err
+}
+
+// post makes a single delivery attempt and reports whether a failure is worth retrying
+func (nd *NotificationDispatcher) post(endpoint string, postBody []byte, headers map[string]string) (body []byte, retryAfter time.Duration, retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(postBody))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := nd.Client.Do(req)
+	if err != nil {
+		// network errors and timeouts
+		return nil, 0, true, err
+	}
+	defer resp.Body.Close()
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return body, 0, false, nil
+	}
+
+	err = fmt.Errorf("got %v status code, response body: %v", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return body, parseRetryAfter(resp.Header.Get("Retry-After")), true, err
+	}
+	return body, 0, false, err
+}
+
+// backoff doubles the wait time after every attempt up to the max backoff
+func (nd *NotificationDispatcher) backoff(attempt int) time.Duration {
+	wait := nd.BaseBackoff
+	for i := 1; i < attempt && wait < nd.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > nd.MaxBackoff {
+		wait = nd.MaxBackoff
+	}
+	return wait
+}
+
+// deadLetter appends undelivered message to the dead letter file
+func (nd *NotificationDispatcher) deadLetter(backend, endpoint string, attempts int, deliveryErr error, postBody []byte) {
+	if nd.DeadLetterFile == "" {
+		return
+	}
+
+	dl := DeadLetter{
+		Timestamp: CurrentUTCDateTime(),
+		RunID:     RUN_ID,
+		Backend:   backend,
+		Endpoint:  redactURL(endpoint),
+		Attempts:  attempts,
+		Error:     deliveryErr.Error(),
+		Payload:   postBody,
+	}
+	line, err := json.Marshal(dl)
+	if err != nil {
+		Logger.Error("Error marshaling dead letter", LOG_ERROR, err)
+		return
+	}
+
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+	f, err := os.OpenFile(nd.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		Logger.Error("Unable to open dead letter file", "file", nd.DeadLetterFile, LOG_ERROR, err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		Logger.Error("Unable to write to dead letter file", "file", nd.DeadLetterFile, LOG_ERROR, err)
+	}
+}
+
+// parseRetryAfter supports both formats of 'Retry-After' header i.e. delay in seconds and http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// redactURL strips path and query from url as webhook urls carry secrets in them
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// ECR_BATCH_DELETE_LIMIT is the max number of image ids accepted by a single BatchDeleteImage request.
+const ECR_BATCH_DELETE_LIMIT = 100
+
+// ECRManager exposes methods to interact with AWS ECR service via SDK.
+type ECRManager struct {
+	TargetAccountId string
+	NukeRoleARN     string
+	AWSProfile      string
+	AWSRegion       string
+	EndpointURL     *string
+}
+
+// PurgeRepository deletes all images from a particular ECR repository and returns the number of images deleted.
+// ECR refuses to delete a repository which still has images, so this needs to run before the stack is deleted.
+func (em ECRManager) PurgeRepository(ctx context.Context, repositoryName string) (int, error) {
+	svc, err := em.Session(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	Logger.Info("Purging images from repository", "repository", repositoryName)
+
+	imageIds := []types.ImageIdentifier{}
+	paginator := ecr.NewListImagesPaginator(svc, &ecr.ListImagesInput{RepositoryName: aws.String(repositoryName)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("Error listing images from repository '%v': %v", repositoryName, err)
+		}
+		imageIds = append(imageIds, page.ImageIds...)
+	}
+
+	// a tagged image is listed once per tag, so images are counted by their digest
+	deletedDigests := map[string]bool{}
+	for start := 0; start < len(imageIds); start += ECR_BATCH_DELETE_LIMIT {
+		end := start + ECR_BATCH_DELETE_LIMIT
+		if end > len(imageIds) {
+			end = len(imageIds)
+		}
+
+		resp, err := svc.BatchDeleteImage(ctx, &ecr.BatchDeleteImageInput{
+			RepositoryName: aws.String(repositoryName),
+			ImageIds:       imageIds[start:end],
+		})
+		if err != nil {
+			return len(deletedDigests), fmt.Errorf("Unable to delete images from repository '%v': %v", repositoryName, err)
+		}
+		for _, id := range resp.ImageIds {
+			deletedDigests[aws.ToString(id.ImageDigest)] = true
+		}
+
+		// a tagged image is listed once per tag, so deleting one tag might have already removed the image of the next one
+		for _, failure := range resp.Failures {
+			if failure.FailureCode == types.ImageFailureCodeImageNotFound {
+				continue
+			}
+			return len(deletedDigests), fmt.Errorf("Unable to delete image from repository '%v'. Code: %v, Reason: %v", repositoryName, failure.FailureCode, aws.ToString(failure.FailureReason))
+		}
+	}
+
+	Logger.Info("Repository purged successfully", "repository", repositoryName, "images_deleted", len(deletedDigests))
+
+	return len(deletedDigests), nil
+}
+
+// Session returns the shared aws ECR client.
+// By default, it uses given aws profile or the default credential chain but it also provides option to assume a different role.
+// It also has validation for target account id to ensure we are deleting in the correct aws account.
+func (em ECRManager) Session(ctx context.Context) (*ecr.Client, error) {
+	if err := validateTargetAccount(ctx, em.AWSProfile, em.AWSRegion, em.EndpointURL, em.TargetAccountId, "ECR"); err != nil {
+		return nil, err
+	}
+	cfg, err := NewAWSConfig(em.AWSProfile, em.AWSRegion, em.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("ecr", em.AWSProfile, cfg, em.NukeRoleARN, ecr.NewFromConfig), nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPurgeRepositoryCountsImagesByDigest(t *testing.T) {
+	endpoint := fakeAWSEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch target := r.Header.Get("X-Amz-Target"); {
+		case strings.HasSuffix(target, ".ListImages"):
+			io.WriteString(w, `{"imageIds":[{"imageDigest":"sha256:a","imageTag":"v1"},{"imageDigest":"sha256:a","imageTag":"latest"},{"imageDigest":"sha256:b"}]}`)
+		case strings.HasSuffix(target, ".BatchDeleteImage"):
+			var in struct {
+				ImageIds []map[string]string `json:"imageIds"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			json.NewEncoder(w).Encode(map[string]interface{}{"imageIds": in.ImageIds, "failures": []interface{}{}})
+		default:
+			t.Errorf("unexpected request %v", target)
+		}
+	})
+
+	em := ECRManager{AWSRegion: "us-east-1", EndpointURL: endpoint}
+	deleted, err := em.PurgeRepository(context.Background(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 images deleted, got %v", deleted)
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// LIFECYCLE_EVENT_VERSION is the version of the lifecycle event schema. It only changes on backward incompatible changes.
+const LIFECYCLE_EVENT_VERSION = "1"
+
+// LIFECYCLE_EVENT_SOURCE is the source of events put to EventBridge.
+const LIFECYCLE_EVENT_SOURCE = "cfn-teardown"
+
+// Lifecycle event types
+var (
+	RUN_STARTED          = "RunStarted"
+	STACK_DELETE_STARTED = "StackDeleteStarted"
+	STACK_DELETED        = "StackDeleted"
+	STACK_FAILED         = "StackFailed"
+	RUN_FINISHED         = "RunFinished"
+)
+
+// Run statuses of RunFinished event
+var (
+	RUN_SUCCEEDED = "Succeeded"
+	RUN_FAILED    = "Failed"
+	RUN_STUCK     = "Stuck"
+)
+
+// EventPublisher publishes teardown lifecycle events to an SNS topic and/or an EventBridge bus for downstream automation.
+// It uses the same aws profile, role and target account validation as the rest of the managers.
+type EventPublisher struct {
+	TargetAccountId string
+	NukeRoleARN     string
+	AWSProfile      string
+	AWSRegion       string
+	EndpointURL     *string
+	SNSTopicARN     string        // skipped if empty
+	EventBusName    string        // skipped if empty
+	Timeout         time.Duration // timeout of publishing a single event, no timeout if zero
+}
+
+// LifecycleEvent is the payload published for every lifecycle event.
+// Fields must only be added to keep the schema backward compatible for the consumers.
+type LifecycleEvent struct {
+	Version      string               `json:"version"`
+	Event        string               `json:"event"` // RunStarted | StackDeleteStarted | StackDeleted | StackFailed | RunFinished
+	RunID        string               `json:"run_id"`
+	Timestamp    string               `json:"timestamp"`
+	AccountID    string               `json:"account_id"`
+	Region       string               `json:"region"`
+	StackPattern string               `json:"stack_pattern"`
+	Status       string               `json:"status,omitempty"` // only present for RunFinished event: Succeeded | Failed | Stuck
+	Message      string               `json:"message"`
+	Stack        *LifecycleEventStack `json:"stack,omitempty"` // only present for stack events
+	Stats        WebhookEventStats    `json:"stats"`
+}
+
+// LifecycleEventStack is the stack a lifecycle event is about.
+type LifecycleEventStack struct {
+	StackName             string                   `json:"stack_name"`
+	Region                string                   `json:"region"`
+	AccountID             string                   `json:"account_id,omitempty"` // only present for accounts listed in the accounts manifest
+	Status                string                   `json:"status"`
+	StatusReason          string                   `json:"status_reason"`
+	DeleteAttempt         int16                    `json:"delete_attempt"`
+	DeleteStartedAt       string                   `json:"delete_started_at"`
+	DeleteCompletedAt     string                   `json:"delete_completed_at"`
+	DeletionTimeInMinutes string                   `json:"deletion_time_in_minutes"`
+	FailedResources       []LifecycleEventResource `json:"failed_resources"`
+}
+
+// LifecycleEventResource is a resource which failed to delete.
+type LifecycleEventResource struct {
+	LogicalResourceID  string `json:"logical_resource_id"`
+	PhysicalResourceID string `json:"physical_resource_id"`
+	ResourceType       string `json:"resource_type"`
+	StatusReason       string `json:"status_reason"`
+	Cause              string `json:"cause"`
+}
+
+// StartAlert publishes RunStarted event
+func (ep EventPublisher) StartAlert(am AlertMessage) error {
+	return ep.publish(ep.event(am, RUN_STARTED, "", nil))
+}
+
+// StackDeleteStartedAlert publishes StackDeleteStarted event for every delete request including retries
+func (ep EventPublisher) StackDeleteStartedAlert(am AlertMessage) error {
+	return ep.publish(ep.event(am, STACK_DELETE_STARTED, "", &am.Stack))
+}
+
+// StackDeletedAlert publishes StackDeleted event
+func (ep EventPublisher) StackDeletedAlert(am AlertMessage) error {
+	return ep.publish(ep.event(am, STACK_DELETED, "", &am.Stack))
+}
+
+// ErrorAlert publishes StackFailed event if the error is about a stack followed by RunFinished event as the teardown stops on errors
+func (ep EventPublisher) ErrorAlert(am AlertMessage) error {
+	if am.FailedStack.StackName != "" {
+		if err := ep.publish(ep.event(am, STACK_FAILED, "", &am.FailedStack)); err != nil {
+			return err
+		}
+	}
+	return ep.publish(ep.event(am, RUN_FINISHED, RUN_FAILED, nil))
+}
+
+// StuckAlert publishes RunFinished event with stuck status
+func (ep EventPublisher) StuckAlert(am AlertMessage) error {
+	return ep.publish(ep.event(am, RUN_FINISHED, RUN_STUCK, nil))
+}
+
+// SuccessAlert publishes RunFinished event with succeeded status
+func (ep EventPublisher) SuccessAlert(am AlertMessage) error {
+	return ep.publish(ep.event(am, RUN_FINISHED, RUN_SUCCEEDED, nil))
+}
+
+// event builds lifecycle event from the alert
+func (ep EventPublisher) event(am AlertMessage, eventType, status string, stack *models.StackDetails) LifecycleEvent {
+	ctx := am.Context
+	event := LifecycleEvent{
+		Version:      LIFECYCLE_EVENT_VERSION,
+		Event:        eventType,
+		RunID:        ctx.RunID,
+		Timestamp:    CurrentUTCDateTime(),
+		AccountID:    ctx.AccountID,
+		Region:       ctx.Region,
+		StackPattern: ctx.StackPattern,
+		Status:       status,
+		Message:      am.Message,
+		Stats: WebhookEventStats{
+			TotalStackCount:   ctx.TotalStackCount,
+			DeletedStackCount: ctx.DeletedStackCount,
+			ActiveStackCount:  ctx.ActiveStackCount,
+			StartedAt:         ctx.StartedAt,
+			UpdatedAt:         ctx.UpdatedAt,
+			DurationInHours:   ctx.DurationInHours,
+		},
+	}
+	if stack != nil {
+		event.Stack = &LifecycleEventStack{
+			StackName:             stack.StackName,
+			Region:                stack.Region,
+			AccountID:             stack.AccountID,
+			Status:                stack.Status,
+			StatusReason:          stack.StackStatusReason,
+			DeleteAttempt:         stack.DeleteAttempt,
+			DeleteStartedAt:       stack.DeleteStartedAt,
+			DeleteCompletedAt:     stack.DeleteCompletedAt,
+			DeletionTimeInMinutes: stack.DeletionTimeInMinutes,
+			FailedResources:       []LifecycleEventResource{},
+		}
+		for _, r := range stack.FailedResources {
+			event.Stack.FailedResources = append(event.Stack.FailedResources, LifecycleEventResource{
+				LogicalResourceID:  r.LogicalResourceId,
+				PhysicalResourceID: r.PhysicalResourceId,
+				ResourceType:       r.ResourceType,
+				StatusReason:       r.StatusReason,
+				Cause:              r.Cause,
+			})
+		}
+	}
+	return event
+}
+
+// publish sends the event within the timeout of the publisher as alerts are not bound to a context.
+func (ep EventPublisher) publish(event LifecycleEvent) error {
+	ctx := context.Background()
+	if ep.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ep.Timeout)
+		defer cancel()
+	}
+	return ep.Publish(ctx, event)
+}
+
+// Publish sends the event to the SNS topic and the EventBridge bus whichever are configured.
+// SNS messages carry the event type as 'event' message attribute so that subscriptions can filter them.
+func (ep EventPublisher) Publish(ctx context.Context, event LifecycleEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if ep.SNSTopicARN != "" {
+		svc, err := ep.SNSSession(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = svc.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(ep.SNSTopicARN),
+			Message:  aws.String(string(payload)),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				"event": {DataType: aws.String("String"), StringValue: aws.String(event.Event)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to publish '%v' event to SNS topic: %v", event.Event, err)
+		}
+	}
+
+	if ep.EventBusName != "" {
+		svc, err := ep.EventBridgeSession(ctx)
+		if err != nil {
+			return err
+		}
+		resp, err := svc.PutEvents(ctx, &eventbridge.PutEventsInput{
+			Entries: []ebtypes.PutEventsRequestEntry{
+				{
+					EventBusName: aws.String(ep.EventBusName),
+					Source:       aws.String(LIFECYCLE_EVENT_SOURCE),
+					DetailType:   aws.String(event.Event),
+					Detail:       aws.String(string(payload)),
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to put '%v' event to EventBridge bus: %v", event.Event, err)
+		}
+		// PutEvents reports failure of individual entries in the response instead of an error
+		if resp.FailedEntryCount > 0 {
+			entry := resp.Entries[0]
+			return fmt.Errorf("Unable to put '%v' event to EventBridge bus: %v %v", event.Event, aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+		}
+	}
+	return nil
+}
+
+// SNSSession returns the shared aws sns client.
+func (ep EventPublisher) SNSSession(ctx context.Context) (*sns.Client, error) {
+	if err := validateTargetAccount(ctx, ep.AWSProfile, ep.AWSRegion, ep.EndpointURL, ep.TargetAccountId, "Events"); err != nil {
+		return nil, err
+	}
+	cfg, err := NewAWSConfig(ep.AWSProfile, ep.AWSRegion, ep.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("sns", ep.AWSProfile, cfg, ep.NukeRoleARN, sns.NewFromConfig), nil
+}
+
+// EventBridgeSession returns the shared aws eventbridge client.
+func (ep EventPublisher) EventBridgeSession(ctx context.Context) (*eventbridge.Client, error) {
+	if err := validateTargetAccount(ctx, ep.AWSProfile, ep.AWSRegion, ep.EndpointURL, ep.TargetAccountId, "Events"); err != nil {
+		return nil, err
+	}
+	cfg, err := NewAWSConfig(ep.AWSProfile, ep.AWSRegion, ep.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("eventbridge", ep.AWSProfile, cfg, ep.NukeRoleARN, eventbridge.NewFromConfig), nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// IAMManager exposes methods to simulate IAM permissions of the principal deleting the stacks of a target via SDK.
+type IAMManager struct {
+	TargetAccountId string // account of the stacks, defaults to the account of the principal
+	NukeRoleARN     string
+	AWSProfile      string
+	AWSRegion       string
+	EndpointURL     *string
+}
+
+// DeniedAction is an action which the principal is not allowed to perform on a resource.
+type DeniedAction struct {
+	Action   string
+	Resource string
+	Decision string // implicitDeny or explicitDeny
+}
+
+// PrincipalARN returns ARN of the IAM user or role whose policies are simulated i.e. the role if role arn is provided, otherwise the caller.
+// Assumed role sessions are resolved to their role as policies can't be simulated for sessions.
+// Empty ARN is returned for the root user as it is allowed to perform all actions.
+func (im IAMManager) PrincipalARN(ctx context.Context) (string, error) {
+	if im.NukeRoleARN != "" {
+		return im.NukeRoleARN, nil
+	}
+
+	cfg, err := NewAWSConfig(im.AWSProfile, im.AWSRegion, im.EndpointURL)
+	if err != nil {
+		return "", err
+	}
+	identity, err := callerIdentity(ctx, cfg, im.AWSProfile, "")
+	if err != nil {
+		return "", err
+	}
+	callerARN := aws.ToString(identity.Arn)
+
+	// e.g. arn:aws:iam::121212121212:user/ci, arn:aws:sts::121212121212:assumed-role/ci/cfn-teardown or arn:aws:iam::121212121212:root
+	parts := strings.SplitN(callerARN, ":", 6)
+	if len(parts) != 6 {
+		return "", fmt.Errorf("Invalid caller ARN '%v'", callerARN)
+	}
+	resource := parts[5]
+	switch {
+	case resource == "root":
+		return "", nil
+	case strings.HasPrefix(resource, "user/"):
+		return callerARN, nil
+	case strings.HasPrefix(resource, "assumed-role/"):
+		// role name is looked up as the session ARN does not include the path of the role
+		roleName := strings.Split(resource, "/")[1]
+		svc, err := im.Session(ctx)
+		if err != nil {
+			return "", err
+		}
+		resp, err := svc.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return "", fmt.Errorf("Unable to find role '%v' of the caller: %v", roleName, err)
+		}
+		return aws.ToString(resp.Role.Arn), nil
+	}
+	return "", fmt.Errorf("Permissions of caller '%v' can't be simulated. Only IAM users and roles are supported", callerARN)
+}
+
+// AccountID returns id of the aws account whose stacks are checked i.e. the target account if set, otherwise the account of the
+// assumed role if role arn is provided or of the aws profile.
+func (im IAMManager) AccountID(ctx context.Context) (string, error) {
+	if im.TargetAccountId != "" {
+		return im.TargetAccountId, nil
+	}
+	cfg, err := NewAWSConfig(im.AWSProfile, im.AWSRegion, im.EndpointURL)
+	if err != nil {
+		return "", err
+	}
+	return CallerAccountID(ctx, cfg, im.AWSProfile, im.NukeRoleARN)
+}
+
+// SimulatePermissions evaluates policies of the principal for the actions on the resource and returns the actions which are not allowed.
+// Only identity based policies, permissions boundaries and organization SCPs are taken into account, resource based policies are not.
+func (im IAMManager) SimulatePermissions(ctx context.Context, principalARN, resource string, actions []string) ([]DeniedAction, error) {
+	denied := []DeniedAction{}
+	svc, err := im.Session(ctx)
+	if err != nil {
+		return denied, err
+	}
+
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(svc, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalARN),
+		ActionNames:     actions,
+		ResourceArns:    []string{resource},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return denied, err
+		}
+		for _, result := range page.EvaluationResults {
+			if result.EvalDecision == types.PolicyEvaluationDecisionTypeAllowed {
+				continue
+			}
+			denied = append(denied, DeniedAction{
+				Action:   aws.ToString(result.EvalActionName),
+				Resource: aws.ToString(result.EvalResourceName),
+				Decision: string(result.EvalDecision),
+			})
+		}
+	}
+	return denied, nil
+}
+
+// Session returns the shared aws iam client.
+// Policies are simulated in the account of the principal i.e. using credentials of the role if role arn is provided, so the principal
+// needs 'iam:SimulatePrincipalPolicy' on itself and 'iam:GetRole' if it is an assumed role session.
+func (im IAMManager) Session(ctx context.Context) (*iam.Client, error) {
+	cfg, err := NewAWSConfig(im.AWSProfile, im.AWSRegion, im.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("iam", im.AWSProfile, cfg, im.NukeRoleARN, iam.NewFromConfig), nil
+}
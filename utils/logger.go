@@ -0,0 +1,181 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/color"
+)
+
+// Logger is the structured logger shared by all components. It is configured by InitLogger from LOG_FORMAT and LOG_LEVEL.
+var Logger = slog.New(NewColorHandler(os.Stdout, slog.LevelInfo))
+
+// Keys of log fields which are common across components so that logs can be queried consistently.
+const (
+	LOG_RUN_ID   = "run_id"
+	LOG_STACK    = "stack"
+	LOG_ATTEMPT  = "attempt"
+	LOG_STATUS   = "status"
+	LOG_DURATION = "duration"
+	LOG_ERROR    = "error"
+)
+
+// LOG_FORMATS lists supported log formats. 'text' is coloured human readable output and 'json' is one json object per line for log aggregators.
+var LOG_FORMATS = []string{"text", "json"}
+
+// InitLogger replaces the shared logger as per the given format and level.
+// In json format every line carries the run id, text format prints it once at the start of the run instead.
+func InitLogger(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("Invalid log level '%v'. Supported levels: debug, info, warn, error", level)
+	}
+
+	switch strings.ToLower(format) {
+	case "text":
+		Logger = slog.New(NewColorHandler(os.Stdout, lvl))
+	case "json":
+		Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})).With(LOG_RUN_ID, RUN_ID)
+	default:
+		return fmt.Errorf("Invalid log format '%v'. Supported formats: %v", format, strings.Join(LOG_FORMATS, ", "))
+	}
+	return nil
+}
+
+// LogDuration formats deletion time in minutes e.g. '3.25' as duration field e.g. '3m15s'.
+func LogDuration(minutes string) string {
+	m, err := strconv.ParseFloat(minutes, 64)
+	if err != nil {
+		return minutes
+	}
+	return (time.Duration(m * float64(time.Minute))).Round(time.Second).String()
+}
+
+// ColorHandler is a slog handler for humans. Messages are coloured by level followed by the fields in gray.
+// Colours are dropped automatically when the output is not a terminal.
+type ColorHandler struct {
+	out   io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	group string // prefix of keys added after WithGroup
+
+	mu *sync.Mutex
+}
+
+// NewColorHandler creates handler writing logs of given level and above to out.
+func NewColorHandler(out io.Writer, level slog.Leveler) *ColorHandler {
+	return &ColorHandler{out: out, level: level, mu: &sync.Mutex{}}
+}
+
+// Enabled reports whether the handler handles records at the given level.
+func (h *ColorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes the record as a single line.
+func (h *ColorHandler) Handle(_ context.Context, r slog.Record) error {
+	var line bytes.Buffer
+
+	switch {
+	case r.Level >= slog.LevelError:
+		line.WriteString(color.Error.Render(r.Message))
+	case r.Level >= slog.LevelWarn:
+		line.WriteString(color.Yellow.Render(r.Message))
+	case r.Level < slog.LevelInfo:
+		line.WriteString(color.Gray.Render(r.Message))
+	default:
+		line.WriteString(r.Message)
+	}
+
+	fields := []string{}
+	for _, a := range h.attrs {
+		fields = appendAttr(fields, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+	if len(fields) > 0 {
+		line.WriteString(" " + color.Gray.Render(strings.Join(fields, " ")))
+	}
+	line.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(line.Bytes())
+	return err
+}
+
+// WithAttrs returns a handler which adds given fields to every record.
+func (h *ColorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		nh.attrs = append(nh.attrs, a)
+	}
+	return &nh
+}
+
+// WithGroup returns a handler which prefixes keys of the following fields with the group name.
+func (h *ColorHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	nh.group = name
+	return &nh
+}
+
+// appendAttr formats field as key=value. Values with spaces are quoted.
+func appendAttr(fields []string, group string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, key, ga)
+		}
+		return fields
+	}
+	value := a.Value.String()
+	if strings.ContainsAny(value, " =\"") || value == "" {
+		value = strconv.Quote(value)
+	}
+	return append(fields, key+"="+value)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// METRICS_NAMESPACE prefixes names of all metrics.
+const METRICS_NAMESPACE = "cfn_teardown"
+
+// RUN_RUNNING is the status of the run info metric until the teardown ends.
+const RUN_RUNNING = "Running"
+
+// MetricsRegistry holds teardown metrics. A dedicated registry is used so that only teardown metrics are pushed to the Pushgateway.
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	stacksTotalGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "stacks_total",
+		Help:      "Number of stacks matching the stack pattern.",
+	})
+	stacksDeletedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "stacks_deleted",
+		Help:      "Number of stacks deleted so far.",
+	})
+	stacksFailedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "stacks_failed",
+		Help:      "Number of stacks which failed to delete.",
+	})
+	deletionsInFlightGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "deletions_in_flight",
+		Help:      "Number of stacks currently in DELETE_IN_PROGRESS state.",
+	})
+	stackDeletionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "stack_deletion_duration_seconds",
+		Help:      "Time taken to delete a stack from the first delete request until DELETE_COMPLETE.",
+		// stacks take from seconds to hours to delete e.g. cloudfront distributions
+		Buckets: []float64{30, 60, 120, 300, 600, 900, 1800, 3600, 7200},
+	})
+	runDurationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "run_duration_seconds",
+		Help:      "Run time of the teardown until now.",
+	})
+	runInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "run_info",
+		Help:      "Run id and status of the teardown. Value is always 1.",
+	}, []string{"run_id", "status"})
+	awsAPICalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "aws_api_calls_total",
+		Help:      "Number of AWS API requests including retries.",
+	}, []string{"service", "operation"})
+	awsAPIThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "aws_api_throttles_total",
+		Help:      "Number of AWS API requests rejected due to throttling.",
+	}, []string{"service", "operation"})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		stacksTotalGauge,
+		stacksDeletedGauge,
+		stacksFailedGauge,
+		deletionsInFlightGauge,
+		stackDeletionDuration,
+		runDurationGauge,
+		runInfoGauge,
+		awsAPICalls,
+		awsAPIThrottles,
+	)
+}
+
+// StartMetricsServer serves metrics on '/metrics' of the given address in background.
+// The teardown goes on even if the listener fails e.g. port is already in use.
+func StartMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		Logger.Info("Serving metrics", "address", addr, "path", "/metrics")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Logger.Error("Unable to serve metrics", "address", addr, LOG_ERROR, err)
+		}
+	}()
+}
+
+// PushMetrics pushes the current metrics to the Pushgateway replacing metrics previously pushed for the same job and stack pattern.
+func PushMetrics(url, job, stackPattern string) error {
+	return push.New(url, job).
+		Gatherer(MetricsRegistry).
+		Grouping("stack_pattern", stackPattern).
+		Push()
+}
+
+// SetRunStatus marks the status of the run in the run info metric.
+func SetRunStatus(status string) {
+	runInfoGauge.Reset()
+	runInfoGauge.WithLabelValues(RUN_ID, status).Set(1)
+}
+
+// updateStackMetrics refreshes stack gauges from the dependency tree.
+func updateStackMetrics(dt map[string]models.StackDetails) {
+	deleted, failed, inFlight := 0, 0, 0
+	for _, stack := range dt {
+		switch stackOutcome(stack) {
+		case STACK_DELETED_OUTCOME:
+			deleted++
+		case STACK_FAILED_OUTCOME:
+			failed++
+		}
+		if stack.Status == models.DELETE_IN_PROGRESS {
+			inFlight++
+		}
+	}
+	stacksTotalGauge.Set(float64(TOTAL_STACK_COUNT))
+	stacksDeletedGauge.Set(float64(deleted))
+	stacksFailedGauge.Set(float64(failed))
+	deletionsInFlightGauge.Set(float64(inFlight))
+	runDurationGauge.Set(NUKE_DURATION_IN_HRS * 3600)
+}
+
+// observeStackDeletion records deletion time of a deleted stack including all of its delete attempts, same as DeletionTimeInMinutes.
+func observeStackDeletion(stack models.StackDetails) {
+	if (stack.FirstDeleteStartedAt == "" && stack.DeleteStartedAt == "") || stack.DeleteCompletedAt == "" {
+		return
+	}
+	minutes, err := strconv.ParseFloat(stackDeletionMinutes(stack), 64)
+	if err != nil {
+		return
+	}
+	stackDeletionDuration.Observe(minutes * 60)
+}
+
+// instrumentAPIOptions counts every attempt of AWS API requests and the ones which were throttled.
+// The middleware runs after the retry middleware so that each retry is counted as well.
+var instrumentAPIOptions = []func(*middleware.Stack) error{
+	func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("CountAPICalls", countAPICall), "Retry", middleware.After)
+	},
+}
+
+// countAPICall labels the attempt with lower case service id e.g. 'cloudformation'.
+func countAPICall(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleFinalize(ctx, in)
+	service := strings.ToLower(strings.ReplaceAll(awsmiddleware.GetServiceID(ctx), " ", ""))
+	operation := awsmiddleware.GetOperationName(ctx)
+	awsAPICalls.WithLabelValues(service, operation).Inc()
+	if err != nil && retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		awsAPIThrottles.WithLabelValues(service, operation).Inc()
+	}
+	return out, metadata, err
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func deletionDurationSum(t *testing.T) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := stackDeletionDuration.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestObserveStackDeletionIncludesRetries(t *testing.T) {
+	count, sum := deletionDurationSum(t)
+
+	stack := models.StackDetails{
+		StackName:            "qa-vpc",
+		FirstDeleteStartedAt: "2021-02-07T03:30:00Z",
+		DeleteStartedAt:      "2021-02-07T03:50:00Z", // retried after the first attempt failed
+		DeleteCompletedAt:    "2021-02-07T04:00:00Z",
+		DeleteAttempt:        2,
+	}
+	// recorded by the deleter and shown in reports, alerts and events
+	stack.DeletionTimeInMinutes = stackDeletionMinutes(stack)
+	if stack.DeletionTimeInMinutes != "30.00" {
+		t.Errorf("expected 30.00 minutes from the first delete request, got %v", stack.DeletionTimeInMinutes)
+	}
+	observeStackDeletion(stack)
+
+	newCount, newSum := deletionDurationSum(t)
+	if newCount != count+1 {
+		t.Fatalf("expected one observation, got %v", newCount-count)
+	}
+	if observed := newSum - sum; observed != 1800 {
+		t.Errorf("expected 1800 seconds from the first delete request, got %v", observed)
+	}
+}
+
+func TestStackDeletionMinutesWithoutRetries(t *testing.T) {
+	// stacks tracked before the first delete request was recorded separately
+	stack := models.StackDetails{DeleteStartedAt: "2021-02-07T03:50:00Z", DeleteCompletedAt: "2021-02-07T04:00:00Z"}
+	if minutes := stackDeletionMinutes(stack); minutes != "10.00" {
+		t.Errorf("expected 10.00 minutes from the latest delete request, got %v", minutes)
+	}
+}
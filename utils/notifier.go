@@ -18,308 +18,212 @@ limitations under the License.
 package utils
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"time"
 
 	"github.com/nirdosh17/cfn-teardown/models"
 )
 
-// NotificationManager exposes methods for sending alerts to slack channel.
+// Notifier is implemented by all notification backends e.g. Slack, Microsoft Teams and generic webhook.
+type Notifier interface {
+	StartAlert(am AlertMessage) error
+	ErrorAlert(am AlertMessage) error
+	StuckAlert(am AlertMessage) error
+	SuccessAlert(am AlertMessage) error
+}
+
+// StackNotifier is implemented by notification backends which also report progress of individual stacks.
+type StackNotifier interface {
+	StackDeletedAlert(am AlertMessage) error
+}
+
+// StackDeleteNotifier is implemented by notification backends which report every delete request of a stack.
+type StackDeleteNotifier interface {
+	StackDeleteStartedAlert(am AlertMessage) error
+}
+
+// ProgressNotifier is implemented by notification backends which report periodic progress of the teardown.
+type ProgressNotifier interface {
+	ProgressAlert(am AlertMessage) error
+}
+
+// PlanNotifier is implemented by notification backends which report the plan of a dry run.
+type PlanNotifier interface {
+	PlanAlert(am AlertMessage) error
+}
+
+// NotificationManager exposes methods for sending alerts to all configured notification backends at once.
 type NotificationManager struct {
-	StackPattern    string
-	DryRun          string
-	SlackWebHookURL string // Webhook url is specific to channel
+	DryRun       string
+	NotifyDryRun bool // send plan alert in dry run mode
+	Notifiers    []Notifier
+	Context      NotificationContext // details of the run shared by all alerts e.g. run id, account and region
 }
 
-// AlertMessage is the structure of a alert event which is translated to slack message later.
+// AlertMessage is the structure of a alert event which is translated to backend specific message later.
 type AlertMessage struct {
 	Message     string // Long message with details about the event
 	Event       string // Start | Complete | Error
 	FailedStack models.StackDetails
+	Stack       models.StackDetails // stack the event is about e.g. deleted stack
+	Progress    ProgressDetails     // only for progress event
+	Plan        PlanDetails         // only for plan event
 	Attachment  map[string]interface{}
+	Context     NotificationContext // template data, populated right before the alert is sent
 }
 
-// SlackMessage is the structure accepted by Slack post message api.
-// More info: https://app.slack.com/block-kit-builder
-type SlackMessage struct {
-	Attachments []map[string]interface{} `json:"attachments"`
-}
+// NewNotificationManager registers a notifier for every notification backend present in the config.
+// Message templates are loaded here so that an invalid custom template fails the run before anything is deleted.
+func NewNotificationManager(config models.Config) (NotificationManager, error) {
+	nm := NotificationManager{
+		DryRun:       config.DryRun,
+		NotifyDryRun: config.NotifyDryRun,
+		Context:      NotificationContext{RunID: RUN_ID, StackPattern: config.StackPattern, Region: config.AWSRegion},
+	}
 
-// ColorMapping is the mapping of slack message color based on teardown event types 'Start', 'Complete', 'Error'
-var ColorMapping map[string]string = map[string]string{"Start": "#f0e62e", "Complete": "#25db2e", "Error": "#e81e1e"}
+	templates, err := LoadNotificationTemplates(config.NotificationTemplatesDir)
+	if err != nil {
+		return nm, err
+	}
 
-// StartAlert prepares slack message for teardown start event
-func (nm NotificationManager) StartAlert(am AlertMessage) {
-	am.Event = "Start"
-	am.Attachment = map[string]interface{}{
-		"color": ColorMapping[am.Event],
-		"blocks": []map[string]interface{}{
-			{
-				"type": "header",
-				"text": map[string]string{
-					"type": "plain_text",
-					"text": "Stack Deletion Started",
-				},
-			},
-			{
-				"type": "context",
-				"elements": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": am.Message,
-					},
-				},
-			},
-			{
-				"type": "divider",
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": ("*Stack Pattern* \n " + nm.StackPattern),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Stack Count* \n %v", TOTAL_STACK_COUNT),
-					},
-				},
-			},
-		},
+	dispatcher := NewNotificationDispatcher(
+		time.Duration(config.NotificationTimeoutSeconds)*time.Second,
+		config.NotificationMaxAttempts,
+		config.NotificationDeadLetterFile,
+	)
+
+	if config.SlackWebhookURL != "" {
+		nm.Notifiers = append(nm.Notifiers, SlackNotifier{WebhookURL: config.SlackWebhookURL, Templates: templates, Dispatcher: dispatcher})
+	}
+	if config.SlackBotToken != "" {
+		nm.Notifiers = append(nm.Notifiers, &SlackBotNotifier{Token: config.SlackBotToken, Channel: config.SlackChannel, Templates: templates, Dispatcher: dispatcher})
+	}
+	if config.TeamsWebhookURL != "" {
+		nm.Notifiers = append(nm.Notifiers, TeamsNotifier{WebhookURL: config.TeamsWebhookURL, Templates: templates, Dispatcher: dispatcher})
+	}
+	if config.WebhookURL != "" {
+		nm.Notifiers = append(nm.Notifiers, WebhookNotifier{URL: config.WebhookURL, Dispatcher: dispatcher})
+	}
+	if config.SNSTopicARN != "" || config.EventBusName != "" {
+		nm.Notifiers = append(nm.Notifiers, EventPublisher{
+			TargetAccountId: config.TargetAccountId,
+			NukeRoleARN:     config.RoleARN,
+			AWSProfile:      config.AWSProfile,
+			AWSRegion:       config.AWSRegion,
+			EndpointURL:     config.EndpointURL,
+			SNSTopicARN:     config.SNSTopicARN,
+			EventBusName:    config.EventBusName,
+			Timeout:         time.Duration(config.NotificationTimeoutSeconds) * time.Second,
+		})
+	}
+	if config.SMTPHost != "" {
+		layouts, err := LoadEmailLayouts(config.NotificationTemplatesDir)
+		if err != nil {
+			return nm, err
+		}
+		nm.Notifiers = append(nm.Notifiers, EmailNotifier{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.EmailFrom,
+			Timeout:  time.Duration(config.NotificationTimeoutSeconds) * time.Second,
+			Recipients: map[string][]string{
+				"":         ParseRecipients(config.EmailTo),
+				"Plan":     ParseRecipients(config.EmailToPlan),
+				"Start":    ParseRecipients(config.EmailToStart),
+				"Progress": ParseRecipients(config.EmailToProgress),
+				"Error":    ParseRecipients(config.EmailToError),
+				"Stuck":    ParseRecipients(config.EmailToStuck),
+				"Complete": ParseRecipients(config.EmailToComplete),
+			},
+			Templates:  templates,
+			Layouts:    layouts,
+			Dispatcher: dispatcher,
+		})
 	}
-	nm.Alert(am)
+	return nm, nil
 }
 
-// ErrorAlert prepares slack message for stack deletion error
+// StartAlert notifies all backends about teardown start event
+func (nm NotificationManager) StartAlert(am AlertMessage) {
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error { return n.StartAlert(am) })
+}
+
+// ErrorAlert notifies all backends about stack deletion error
 func (nm NotificationManager) ErrorAlert(am AlertMessage) {
-	am.Event = "Error"
-	am.Attachment = map[string]interface{}{
-		"color": ColorMapping[am.Event],
-		"blocks": []map[string]interface{}{
-			{
-				"type": "header",
-				"text": map[string]string{
-					"type": "plain_text",
-					"text": "Stack Deletion Failed",
-				},
-			},
-			{
-				"type": "context",
-				"elements": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": "Manual Intervention Required",
-					},
-				},
-			},
-			{
-				"type": "divider",
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": ("*Stack Pattern* \n " + nm.StackPattern),
-					},
-					{
-						"type": "mrkdwn",
-						"text": "*Runtime* \n" + fmt.Sprintf("%.2f Hour/s", NUKE_DURATION_IN_HRS),
-					},
-				},
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": "*Stacks Deleted* \n" + fmt.Sprintf("%v/%v", DELETED_STACK_COUNT, TOTAL_STACK_COUNT),
-					},
-					{
-						"type": "mrkdwn",
-						"text": "*Failed Stack* \n" + fmt.Sprintf("<%v|%v>", am.FailedStack.CFNConsoleLink, am.FailedStack.StackName),
-					},
-				},
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": "*Reason* \n" + am.FailedStack.StackStatusReason,
-					},
-				},
-			},
-		},
-	}
-	nm.Alert(am)
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error { return n.ErrorAlert(am) })
 }
 
-// StuckAlert prepares slack message when stack teardown is stuck
+// StuckAlert notifies all backends when stack teardown is stuck
 func (nm NotificationManager) StuckAlert(am AlertMessage) {
-	am.Event = "Error"
-	am.Attachment = map[string]interface{}{
-		"color": ColorMapping[am.Event],
-		"blocks": []map[string]interface{}{
-			{
-				"type": "header",
-				"text": map[string]string{
-					"type": "plain_text",
-					"text": "Stack Deletion Stuck",
-				},
-			},
-			{
-				"type": "context",
-				"elements": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": am.Message,
-					},
-				},
-			},
-			{
-				"type": "divider",
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": ("*Stack Pattern* \n " + nm.StackPattern),
-					},
-					{
-						"type": "mrkdwn",
-						"text": "*Runtime* \n" + fmt.Sprintf("%.2f Hour/s", NUKE_DURATION_IN_HRS),
-					},
-				},
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": "*Stacks Deleted* \n" + fmt.Sprintf("%v/%v", DELETED_STACK_COUNT, TOTAL_STACK_COUNT),
-					},
-				},
-			},
-		},
-	}
-	nm.Alert(am)
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error { return n.StuckAlert(am) })
 }
 
-// SuccessAlert prepares slack message for successful completion of stack teardown
+// SuccessAlert notifies all backends about successful completion of stack teardown
 func (nm NotificationManager) SuccessAlert(am AlertMessage) {
-	am.Event = "Complete"
-	am.Attachment = map[string]interface{}{
-		"color": ColorMapping[am.Event],
-		"blocks": []map[string]interface{}{
-			{
-				"type": "header",
-				"text": map[string]string{
-					"type": "plain_text",
-					"text": "Stack Deletion Completed",
-				},
-			},
-			{
-				"type": "divider",
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": ("*Stack Pattern* \n " + nm.StackPattern),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Deleted Stacks* \n %v", TOTAL_STACK_COUNT),
-					},
-				},
-			},
-			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": ("*Started At* \n " + NUKE_START_TIME),
-					},
-					{
-						"type": "mrkdwn",
-						"text": ("*Completed At* \n " + NUKE_END_TIME + fmt.Sprintf("(%.2f Hour/s)", NUKE_DURATION_IN_HRS)),
-					},
-				},
-			},
-		},
-	}
-	nm.Alert(am)
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error { return n.SuccessAlert(am) })
 }
 
-// GenericAlert prepares slack message for a generic message
-func (nm NotificationManager) GenericAlert(am AlertMessage) {
-	am.Event = "Error"
-	am.Attachment = map[string]interface{}{
-		"color": ColorMapping[am.Event],
-		"blocks": []map[string]interface{}{
-			{
-				"type": "header",
-				"text": map[string]string{
-					"type": "plain_text",
-					"text": "Stack Deletion Error",
-				},
-			},
-			{
-				"type": "context",
-				"elements": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": am.Message,
-					},
-				},
-			},
-		},
-	}
-	nm.Alert(am)
+// StackDeletedAlert notifies backends which report progress of individual stacks about a deleted stack
+func (nm NotificationManager) StackDeletedAlert(am AlertMessage) {
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error {
+		if sn, ok := n.(StackNotifier); ok {
+			return sn.StackDeletedAlert(am)
+		}
+		return nil
+	})
 }
 
-// Alert posts message to Slack channel using webhook
-// Only posts the message if it's not a dry run and webhook url is present
-func (nm NotificationManager) Alert(am AlertMessage) error {
-	if nm.DryRun != "false" {
-		return nil
-	}
-	if nm.SlackWebHookURL == "" {
-		// do not make api request
+// StackDeleteStartedAlert notifies backends which report every delete request of a stack
+func (nm NotificationManager) StackDeleteStartedAlert(am AlertMessage) {
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error {
+		if sn, ok := n.(StackDeleteNotifier); ok {
+			return sn.StackDeleteStartedAlert(am)
+		}
 		return nil
-	}
+	})
+}
 
-	msgBody := SlackMessage{
-		Attachments: []map[string]interface{}{am.Attachment},
-	}
+// ProgressAlert notifies backends which report periodic progress of the teardown
+func (nm NotificationManager) ProgressAlert(am AlertMessage) {
+	nm.dispatch(am, func(n Notifier, am AlertMessage) error {
+		if pn, ok := n.(ProgressNotifier); ok {
+			return pn.ProgressAlert(am)
+		}
+		return nil
+	})
+}
 
-	postBody, err := json.Marshal(msgBody)
-	if err != nil {
-		fmt.Printf("[Alert] Error marshaling request body: %v", err)
-		return err
+// PlanAlert notifies backends which report the plan of a dry run.
+// Unlike other alerts, it is only sent in dry run mode and only if enabled.
+func (nm NotificationManager) PlanAlert(am AlertMessage) {
+	if nm.DryRun == "false" || !nm.NotifyDryRun {
+		return
 	}
+	nm.send(am, func(n Notifier, am AlertMessage) error {
+		if pn, ok := n.(PlanNotifier); ok {
+			return pn.PlanAlert(am)
+		}
+		return nil
+	})
+}
 
-	resp, err := http.Post(nm.SlackWebHookURL, "application/json", bytes.NewBuffer(postBody))
-	if err != nil {
-		fmt.Printf("Error posting message to Slack: %v", err)
-		return err
+// dispatch sends the alert only if it's not a dry run.
+func (nm NotificationManager) dispatch(am AlertMessage, send func(n Notifier, am AlertMessage) error) {
+	if nm.DryRun != "false" {
+		return
 	}
-	defer resp.Body.Close()
+	nm.send(am, send)
+}
 
-	//Read the response body
-	body, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		fmt.Printf("Got %v status code from Slack, Response body: %v\n", resp.StatusCode, string(body))
-		fmt.Printf("Request body: %v\n", string(postBody))
-		return fmt.Errorf("Failed to publish message %+v to Slack", msgBody)
+// send populates template data from the current state of the teardown and sends the alert to every notifier.
+// Failure of one backend does not stop the others.
+func (nm NotificationManager) send(am AlertMessage, send func(n Notifier, am AlertMessage) error) {
+	am.Context = newNotificationContext(nm.Context, am)
+	for _, n := range nm.Notifiers {
+		if err := send(n, am); err != nil {
+			Logger.Error("Failed to send alert", "notifier", fmt.Sprintf("%T", n), LOG_ERROR, err)
+		}
 	}
-
-	return nil
 }
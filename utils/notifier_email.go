@@ -0,0 +1,341 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EmailNotifier sends alerts as HTML and plain text multipart emails over SMTP.
+// Every event can be sent to a different set of recipients, falling back to the default recipients.
+type EmailNotifier struct {
+	Host       string
+	Port       int
+	Username   string // smtp auth is skipped if empty
+	Password   string
+	From       string
+	Timeout    time.Duration       // deadline of a whole smtp session from dialing to quitting, defaults to 10 seconds
+	Recipients map[string][]string // event e.g. 'Error' -> recipients, '' -> default recipients
+	Templates  *NotificationTemplates
+	Layouts    *EmailLayouts
+	Dispatcher *NotificationDispatcher
+}
+
+// EmailLayouts wrap the rendered event body with the run summary and failed stack table.
+type EmailLayouts struct {
+	Text *template.Template
+	HTML *htmltemplate.Template
+}
+
+// EmailData is the data passed to email layouts.
+type EmailData struct {
+	Title      string
+	Color      string     // color of the event e.g. red for errors
+	Body       string     // rendered event template
+	Paragraphs [][]string // lines of body grouped by blank lines, used in html layout
+	Context    NotificationContext
+}
+
+// EMAIL_EVENTS lists events which can have their own recipients.
+var EMAIL_EVENTS = []string{"Plan", "Start", "Progress", "Error", "Stuck", "Complete"}
+
+// EMAIL_SKIP_RECIPIENTS disables emails for an event when set as its recipients.
+const EMAIL_SKIP_RECIPIENTS = "none"
+
+// ParseRecipients splits comma separated email addresses.
+func ParseRecipients(value string) []string {
+	recipients := []string{}
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
+
+// LoadEmailLayouts parses built-in email layouts and overrides them with 'email/layout.txt' and 'email/layout.html' found in the given directory.
+func LoadEmailLayouts(dir string) (*EmailLayouts, error) {
+	read := func(name string) (string, error) {
+		content, err := defaultTemplates.ReadFile("templates/email/" + name)
+		if err != nil {
+			return "", fmt.Errorf("Missing built-in template 'email/%v': %v", name, err)
+		}
+		if dir != "" {
+			custom, err := os.ReadFile(filepath.Join(dir, "email", name))
+			if err == nil {
+				Logger.Info("Using custom notification template", "template", filepath.Join(dir, "email", name))
+				content = custom
+			} else if !os.IsNotExist(err) {
+				return "", fmt.Errorf("Unable to read template 'email/%v': %v", name, err)
+			}
+		}
+		return string(content), nil
+	}
+
+	layouts := &EmailLayouts{}
+
+	text, err := read("layout.txt")
+	if err != nil {
+		return nil, err
+	}
+	layouts.Text, err = template.New("email/layout.txt").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template 'email/layout.txt': %v", err)
+	}
+
+	html, err := read("layout.html")
+	if err != nil {
+		return nil, err
+	}
+	layouts.HTML, err = htmltemplate.New("email/layout.html").Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(html)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template 'email/layout.html': %v", err)
+	}
+	return layouts, nil
+}
+
+// PlanAlert emails the plan of a dry run
+func (en EmailNotifier) PlanAlert(am AlertMessage) error {
+	return en.Alert(am, "Plan", "Stack Deletion Plan", "plan")
+}
+
+// StartAlert emails teardown start event
+func (en EmailNotifier) StartAlert(am AlertMessage) error {
+	return en.Alert(am, "Start", "Stack Deletion Started", "start")
+}
+
+// ProgressAlert emails periodic progress of the teardown
+func (en EmailNotifier) ProgressAlert(am AlertMessage) error {
+	return en.Alert(am, "Progress", "Stack Deletion In Progress", "progress")
+}
+
+// ErrorAlert emails stack deletion error
+func (en EmailNotifier) ErrorAlert(am AlertMessage) error {
+	return en.Alert(am, "Error", "Stack Deletion Failed", "error")
+}
+
+// StuckAlert emails when stack teardown is stuck
+func (en EmailNotifier) StuckAlert(am AlertMessage) error {
+	return en.Alert(am, "Stuck", "Stack Deletion Stuck", "stuck")
+}
+
+// SuccessAlert emails successful completion of stack teardown
+func (en EmailNotifier) SuccessAlert(am AlertMessage) error {
+	return en.Alert(am, "Complete", "Stack Deletion Completed", "success")
+}
+
+// Alert renders the email for the event and sends it to the recipients of the event
+func (en EmailNotifier) Alert(am AlertMessage, event, title, templateName string) error {
+	to := en.recipients(event)
+	if len(to) == 0 {
+		return nil
+	}
+
+	am.Context.Event = event
+	am.Context.Title = title
+	body, err := en.Templates.Render("email", templateName, am.Context)
+	if err != nil {
+		return err
+	}
+
+	data := EmailData{Title: title, Color: emailColor(event), Body: body, Context: am.Context}
+	for _, paragraph := range strings.Split(body, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			data.Paragraphs = append(data.Paragraphs, strings.Split(paragraph, "\n"))
+		}
+	}
+
+	var text, html bytes.Buffer
+	if err = en.Layouts.Text.Execute(&text, data); err != nil {
+		return fmt.Errorf("Unable to render template 'email/layout.txt': %v", err)
+	}
+	if err = en.Layouts.HTML.Execute(&html, data); err != nil {
+		return fmt.Errorf("Unable to render template 'email/layout.html': %v", err)
+	}
+
+	subject := fmt.Sprintf("[cfn-teardown] %v: %v", title, am.Context.StackPattern)
+	msg, err := en.message(to, subject, text.String(), html.String())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(en.Host, strconv.Itoa(en.Port))
+	// undelivered emails are dead lettered without the html part to keep the file readable
+	payload, _ := json.Marshal(map[string]interface{}{"to": to, "subject": subject, "text": text.String()})
+	return en.Dispatcher.Deliver("Email", "smtp://"+addr, payload, func() (time.Duration, bool, error) {
+		err := en.send(addr, to, msg)
+		return 0, retryableSMTPError(err), err
+	})
+}
+
+// send delivers the message like smtp.SendMail but the connection is bound by the timeout
+// so that an unresponsive SMTP server can't block the teardown.
+func (en EmailNotifier) send(addr string, to []string, msg []byte) error {
+	timeout := en.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, en.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: en.Host}); err != nil {
+			return err
+		}
+	}
+	if auth := en.auth(); auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(en.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// recipients returns recipients configured for the event or the default recipients
+func (en EmailNotifier) recipients(event string) []string {
+	to, ok := en.Recipients[event]
+	if !ok || len(to) == 0 {
+		to = en.Recipients[""]
+	}
+	if len(to) == 1 && strings.EqualFold(to[0], EMAIL_SKIP_RECIPIENTS) {
+		return nil
+	}
+	return to
+}
+
+// auth uses plain auth if credentials are present.
+// net/smtp refuses to send credentials over unencrypted connections except to localhost.
+func (en EmailNotifier) auth() smtp.Auth {
+	if en.Username == "" {
+		return nil
+	}
+	return smtp.PlainAuth("", en.Username, en.Password, en.Host)
+}
+
+// message builds a multipart/alternative email with plain text and html parts
+func (en EmailNotifier) message(to []string, subject, text, html string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", en.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%v\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// emailColor maps events to the colors used by slack messages
+func emailColor(event string) string {
+	switch event {
+	case "Error", "Stuck":
+		return ColorMapping["Error"]
+	case "Complete":
+		return ColorMapping["Complete"]
+	}
+	return ColorMapping["Start"]
+}
+
+// retryableSMTPError retries network errors and transient 4xx smtp replies. 5xx replies are permanent failures.
+func retryableSMTPError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
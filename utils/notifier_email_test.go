@@ -0,0 +1,172 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a minimal SMTP server which accepts every message and records what it received
+type smtpServer struct {
+	listener   net.Listener
+	recipients chan []string
+	messages   chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &smtpServer{listener: l, recipients: make(chan []string, 10), messages: make(chan string, 10)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	rcpts := []string{}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			rcpts = append(rcpts, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.recipients <- rcpts
+			s.messages <- strings.Join(lines, "\n")
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func testEmailNotifier(t *testing.T, addr string, timeout time.Duration) EmailNotifier {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadNotificationTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts, err := LoadEmailLayouts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := net.LookupPort("tcp", port)
+	return EmailNotifier{
+		Host:       host,
+		Port:       p,
+		From:       "cfn-teardown@example.com",
+		Timeout:    timeout,
+		Recipients: map[string][]string{"": {"team@example.com"}, "Error": {"oncall@example.com", "lead@example.com"}},
+		Templates:  templates,
+		Layouts:    layouts,
+		Dispatcher: NewNotificationDispatcher(timeout, 1, ""),
+	}
+}
+
+func TestEmailAlertIsDeliveredOverSMTP(t *testing.T) {
+	server := newSMTPServer(t)
+	en := testEmailNotifier(t, server.listener.Addr().String(), time.Second)
+
+	am := AlertMessage{Message: "Failed to delete stack `qa-vpc`"}
+	am.Context.StackPattern = "^qa-"
+	if err := en.ErrorAlert(am); err != nil {
+		t.Fatal(err)
+	}
+
+	rcpts := <-server.recipients
+	if strings.Join(rcpts, ",") != "oncall@example.com,lead@example.com" {
+		t.Errorf("expected error recipients, got %v", rcpts)
+	}
+	msg := <-server.messages
+	for _, header := range []string{"From: cfn-teardown@example.com", "To: oncall@example.com, lead@example.com", "Subject: [cfn-teardown] Stack Deletion Failed: ^qa-", "Content-Type: multipart/alternative"} {
+		if !strings.Contains(msg, header) {
+			t.Errorf("expected %q in message:\n%v", header, msg)
+		}
+	}
+}
+
+func TestEmailAlertTimesOutOnUnresponsiveServer(t *testing.T) {
+	// server accepts connections but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			bufio.NewReader(conn).ReadString('\n')
+		}
+	}()
+
+	en := testEmailNotifier(t, l.Addr().String(), 200*time.Millisecond)
+	start := time.Now()
+	err = en.ErrorAlert(AlertMessage{Message: "Failed to delete stack `qa-vpc`"})
+	if err == nil {
+		t.Fatal("expected email delivery to time out")
+	}
+	if !retryableSMTPError(err) {
+		t.Errorf("expected timeout to be retryable, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected delivery to give up after the timeout, took %v", elapsed)
+	}
+}
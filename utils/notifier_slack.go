@@ -0,0 +1,144 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+// SlackNotifier sends alerts to a slack channel using incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string // Webhook url is specific to channel
+	Templates  *NotificationTemplates
+	Dispatcher *NotificationDispatcher
+}
+
+// SlackMessage is the structure accepted by Slack post message api.
+// More info: https://app.slack.com/block-kit-builder
+type SlackMessage struct {
+	Attachments []map[string]interface{} `json:"attachments"`
+}
+
+// ColorMapping is the mapping of slack message color based on teardown event types 'Start', 'Complete', 'Error'
+var ColorMapping map[string]string = map[string]string{"Start": "#f0e62e", "Complete": "#25db2e", "Error": "#e81e1e"}
+
+// SLACK_TEXT_LIMIT is the max length of text in a slack section block.
+const SLACK_TEXT_LIMIT = 3000
+
+// PlanAlert posts slack message with the plan of a dry run
+func (sn SlackNotifier) PlanAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Start", "Stack Deletion Plan", "plan")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// StartAlert posts slack message for teardown start event
+func (sn SlackNotifier) StartAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Start", "Stack Deletion Started", "start")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// ErrorAlert posts slack message for stack deletion error
+func (sn SlackNotifier) ErrorAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Error", "Stack Deletion Failed", "error")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// StuckAlert posts slack message when stack teardown is stuck
+func (sn SlackNotifier) StuckAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Error", "Stack Deletion Stuck", "stuck")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// SuccessAlert posts slack message for successful completion of stack teardown
+func (sn SlackNotifier) SuccessAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Complete", "Stack Deletion Completed", "success")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// ProgressAlert posts slack message with teardown progress
+func (sn SlackNotifier) ProgressAlert(am AlertMessage) error {
+	am, err := sn.prepare(am, "Start", "Stack Deletion In Progress", "progress")
+	if err != nil {
+		return err
+	}
+	return sn.Alert(am)
+}
+
+// prepare renders message body from the event's template and builds slack attachment with a header and the body
+func (sn SlackNotifier) prepare(am AlertMessage, event, title, templateName string) (AlertMessage, error) {
+	am.Event = event
+	am.Context.Event = event
+	am.Context.Title = title
+
+	text, err := sn.Templates.Render("slack", templateName, am.Context)
+	if err != nil {
+		return am, err
+	}
+
+	am.Attachment = map[string]interface{}{
+		"color": ColorMapping[am.Event],
+		"blocks": []map[string]interface{}{
+			{
+				"type": "header",
+				"text": map[string]string{
+					"type": "plain_text",
+					"text": title,
+				},
+			},
+			{
+				"type": "divider",
+			},
+			{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": truncate(text, SLACK_TEXT_LIMIT),
+				},
+			},
+		},
+	}
+	return am, nil
+}
+
+// Alert posts message to Slack channel using webhook
+func (sn SlackNotifier) Alert(am AlertMessage) error {
+	msgBody := SlackMessage{
+		Attachments: []map[string]interface{}{am.Attachment},
+	}
+	_, err := sn.Dispatcher.PostJSON("Slack", sn.WebhookURL, msgBody, nil)
+	return err
+}
+
+// truncate cuts the text to given length so that messages are not rejected for being too long
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return text[:limit-3] + "..."
+}
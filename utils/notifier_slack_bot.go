@@ -0,0 +1,225 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SlackAPIBaseURL is the base url of Slack Web API.
+var SlackAPIBaseURL = "https://slack.com/api/"
+
+// SlackBotNotifier sends alerts to a slack channel using Slack Web API and a bot token.
+// Instead of posting a message per event, it posts one parent message per run which is updated with live counts
+// and threads the rest of the events under it.
+type SlackBotNotifier struct {
+	Token      string // Bot token with 'chat:write' scope
+	Channel    string // Channel id or name the bot is a member of
+	Templates  *NotificationTemplates
+	Dispatcher *NotificationDispatcher
+
+	// parent message of the run. Set once the start alert is posted.
+	channelID string
+	parentTS  string
+}
+
+// SlackAPIMessage is the structure accepted by chat.postMessage and chat.update apis.
+type SlackAPIMessage struct {
+	Channel     string                   `json:"channel"`
+	Text        string                   `json:"text"`
+	Attachments []map[string]interface{} `json:"attachments,omitempty"`
+	TS          string                   `json:"ts,omitempty"`        // message to update
+	ThreadTS    string                   `json:"thread_ts,omitempty"` // parent message of the thread
+}
+
+// SlackAPIResponse is the common response structure of Slack Web API.
+// Slack responds with 200 status code for failures as well, so 'ok' needs to be checked.
+type SlackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// PlanAlert posts the plan of a dry run as a standalone message as there won't be any further events in the run
+func (sb *SlackBotNotifier) PlanAlert(am AlertMessage) error {
+	am, err := SlackNotifier{Templates: sb.Templates, Dispatcher: sb.Dispatcher}.prepare(am, "Start", "Stack Deletion Plan", "plan")
+	if err != nil {
+		return err
+	}
+	_, err = sb.call("chat.postMessage", SlackAPIMessage{
+		Channel:     sb.channel(),
+		Text:        "Stack Deletion Plan",
+		Attachments: []map[string]interface{}{am.Attachment},
+	})
+	return err
+}
+
+// StartAlert posts parent message of the run and threads the start details under it
+func (sb *SlackBotNotifier) StartAlert(am AlertMessage) error {
+	msg, err := sb.parentMessage(am, "Start", "Stack Deletion In Progress")
+	if err != nil {
+		return err
+	}
+	resp, err := sb.call("chat.postMessage", msg)
+	if err != nil {
+		return err
+	}
+	sb.channelID = resp.Channel
+	sb.parentTS = resp.TS
+	return sb.reply(am, "Start", "Stack Deletion Started", "start")
+}
+
+// ErrorAlert marks parent message as failed and threads the error details under it
+func (sb *SlackBotNotifier) ErrorAlert(am AlertMessage) error {
+	if err := sb.updateParent(am, "Error", "Stack Deletion Failed"); err != nil {
+		return err
+	}
+	return sb.reply(am, "Error", "Stack Deletion Failed", "error")
+}
+
+// StuckAlert marks parent message as stuck and threads the details under it
+func (sb *SlackBotNotifier) StuckAlert(am AlertMessage) error {
+	if err := sb.updateParent(am, "Error", "Stack Deletion Stuck"); err != nil {
+		return err
+	}
+	return sb.reply(am, "Error", "Stack Deletion Stuck", "stuck")
+}
+
+// SuccessAlert marks parent message as completed and threads the summary under it
+func (sb *SlackBotNotifier) SuccessAlert(am AlertMessage) error {
+	if err := sb.updateParent(am, "Complete", "Stack Deletion Completed"); err != nil {
+		return err
+	}
+	return sb.reply(am, "Complete", "Stack Deletion Completed", "success")
+}
+
+// ProgressAlert updates live counts in the parent message and threads the progress summary under it
+func (sb *SlackBotNotifier) ProgressAlert(am AlertMessage) error {
+	if err := sb.updateParent(am, "Start", "Stack Deletion In Progress"); err != nil {
+		return err
+	}
+	return sb.reply(am, "Start", "Stack Deletion In Progress", "progress")
+}
+
+// StackDeletedAlert updates live counts in the parent message and threads the deleted stack under it
+func (sb *SlackBotNotifier) StackDeletedAlert(am AlertMessage) error {
+	if err := sb.updateParent(am, "Start", "Stack Deletion In Progress"); err != nil {
+		return err
+	}
+	text, err := sb.Templates.Render("slack", "stack_deleted", am.Context)
+	if err != nil {
+		return err
+	}
+	_, err = sb.call("chat.postMessage", SlackAPIMessage{Channel: sb.channel(), Text: truncate(text, SLACK_TEXT_LIMIT), ThreadTS: sb.parentTS})
+	return err
+}
+
+// parentMessage shows overall status and live counts of the run
+func (sb *SlackBotNotifier) parentMessage(am AlertMessage, event, title string) (SlackAPIMessage, error) {
+	am.Context.Event = event
+	am.Context.Title = title
+	text, err := sb.Templates.Render("slack", "run_status", am.Context)
+	if err != nil {
+		return SlackAPIMessage{}, err
+	}
+
+	return SlackAPIMessage{
+		Channel: sb.channel(),
+		Text:    title,
+		Attachments: []map[string]interface{}{
+			{
+				"color": ColorMapping[event],
+				"blocks": []map[string]interface{}{
+					{
+						"type": "section",
+						"text": map[string]string{
+							"type": "mrkdwn",
+							"text": truncate(text, SLACK_TEXT_LIMIT),
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// updateParent updates status and counts in the parent message.
+// Events which occur before the run has started e.g. failure to list stacks are posted as new parent message.
+func (sb *SlackBotNotifier) updateParent(am AlertMessage, event, title string) error {
+	msg, err := sb.parentMessage(am, event, title)
+	if err != nil {
+		return err
+	}
+	if sb.parentTS == "" {
+		resp, err := sb.call("chat.postMessage", msg)
+		if err != nil {
+			return err
+		}
+		sb.channelID = resp.Channel
+		sb.parentTS = resp.TS
+		return nil
+	}
+	msg.TS = sb.parentTS
+	_, err = sb.call("chat.update", msg)
+	return err
+}
+
+// reply posts the alert in the thread of the parent message reusing message blocks of webhook based notifier
+func (sb *SlackBotNotifier) reply(am AlertMessage, event, title, templateName string) error {
+	am, err := SlackNotifier{Templates: sb.Templates, Dispatcher: sb.Dispatcher}.prepare(am, event, title, templateName)
+	if err != nil {
+		return err
+	}
+	_, err = sb.call("chat.postMessage", SlackAPIMessage{
+		Channel:     sb.channel(),
+		Attachments: []map[string]interface{}{am.Attachment},
+		ThreadTS:    sb.parentTS,
+	})
+	return err
+}
+
+// channel returns channel id returned by slack once the parent message is posted.
+// chat.update only accepts channel id, not the channel name.
+func (sb *SlackBotNotifier) channel() string {
+	if sb.channelID != "" {
+		return sb.channelID
+	}
+	return sb.Channel
+}
+
+// call invokes a Slack Web API method authenticated by the bot token
+func (sb *SlackBotNotifier) call(method string, msgBody SlackAPIMessage) (SlackAPIResponse, error) {
+	var apiResp SlackAPIResponse
+
+	body, err := sb.Dispatcher.PostJSON("Slack API "+method, SlackAPIBaseURL+method, msgBody, map[string]string{
+		"Content-Type":  "application/json; charset=utf-8",
+		"Authorization": "Bearer " + sb.Token,
+	})
+	if err != nil {
+		return apiResp, err
+	}
+
+	if err = json.Unmarshal(body, &apiResp); err != nil || !apiResp.OK {
+		Logger.Error("Got error from Slack api", "method", method, "response", string(body))
+		return apiResp, fmt.Errorf("Failed to call Slack api '%v': %v", method, apiResp.Error)
+	}
+
+	return apiResp, nil
+}
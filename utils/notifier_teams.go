@@ -0,0 +1,114 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+// TeamsNotifier sends alerts to a Microsoft Teams channel as adaptive cards using incoming webhook.
+type TeamsNotifier struct {
+	WebhookURL string // Webhook url is specific to channel
+	Templates  *NotificationTemplates
+	Dispatcher *NotificationDispatcher
+}
+
+// TeamsMessage is the structure accepted by Teams incoming webhook for adaptive cards.
+// More info: https://adaptivecards.io/designer
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+// TeamsAttachment wraps an adaptive card in a Teams message.
+type TeamsAttachment struct {
+	ContentType string                 `json:"contentType"`
+	Content     map[string]interface{} `json:"content"`
+}
+
+// TeamsColorMapping is the mapping of adaptive card title color based on teardown event types 'Start', 'Complete', 'Error'
+var TeamsColorMapping map[string]string = map[string]string{"Start": "Warning", "Complete": "Good", "Error": "Attention"}
+
+// PlanAlert posts adaptive card with the plan of a dry run
+func (tn TeamsNotifier) PlanAlert(am AlertMessage) error {
+	return tn.Alert(am, "Start", "Stack Deletion Plan", "plan")
+}
+
+// StartAlert posts adaptive card for teardown start event
+func (tn TeamsNotifier) StartAlert(am AlertMessage) error {
+	return tn.Alert(am, "Start", "Stack Deletion Started", "start")
+}
+
+// ErrorAlert posts adaptive card for stack deletion error
+func (tn TeamsNotifier) ErrorAlert(am AlertMessage) error {
+	return tn.Alert(am, "Error", "Stack Deletion Failed", "error")
+}
+
+// StuckAlert posts adaptive card when stack teardown is stuck
+func (tn TeamsNotifier) StuckAlert(am AlertMessage) error {
+	return tn.Alert(am, "Error", "Stack Deletion Stuck", "stuck")
+}
+
+// SuccessAlert posts adaptive card for successful completion of stack teardown
+func (tn TeamsNotifier) SuccessAlert(am AlertMessage) error {
+	return tn.Alert(am, "Complete", "Stack Deletion Completed", "success")
+}
+
+// ProgressAlert posts adaptive card with teardown progress
+func (tn TeamsNotifier) ProgressAlert(am AlertMessage) error {
+	return tn.Alert(am, "Start", "Stack Deletion In Progress", "progress")
+}
+
+// Alert renders message body from the event's template, builds adaptive card with a title and the body
+// and posts it to Teams channel using webhook
+func (tn TeamsNotifier) Alert(am AlertMessage, event, title, templateName string) error {
+	am.Event = event
+	am.Context.Event = event
+	am.Context.Title = title
+
+	text, err := tn.Templates.Render("teams", templateName, am.Context)
+	if err != nil {
+		return err
+	}
+
+	msgBody := TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]interface{}{
+						{
+							"type":   "TextBlock",
+							"text":   title,
+							"size":   "Large",
+							"weight": "Bolder",
+							"color":  TeamsColorMapping[am.Event],
+						},
+						{
+							"type": "TextBlock",
+							"text": text,
+							"wrap": true,
+						},
+					},
+				},
+			},
+		},
+	}
+	_, err = tn.Dispatcher.PostJSON("Teams", tn.WebhookURL, msgBody, nil)
+	return err
+}
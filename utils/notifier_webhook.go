@@ -0,0 +1,203 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// WebhookNotifier posts alerts as plain json to any http endpoint.
+// Payload follows the WebhookEvent schema which is documented in the README.
+type WebhookNotifier struct {
+	URL        string
+	Dispatcher *NotificationDispatcher
+}
+
+// WebhookEvent is the payload posted by the generic webhook notifier.
+// Fields must only be added to keep the schema backward compatible for the consumers.
+type WebhookEvent struct {
+	Event        string                `json:"event"` // Plan | Start | Progress | Error | Stuck | Complete
+	Title        string                `json:"title"`
+	Message      string                `json:"message"`
+	StackPattern string                `json:"stack_pattern"`
+	RunID        string                `json:"run_id"`
+	AccountID    string                `json:"account_id"`
+	Region       string                `json:"region"`
+	Stats        WebhookEventStats     `json:"stats"`
+	FailedStack  *WebhookEventStack    `json:"failed_stack"`       // only present for Error event of a particular stack
+	Progress     *WebhookEventProgress `json:"progress,omitempty"` // only present for Progress event
+	Plan         *WebhookEventPlan     `json:"plan,omitempty"`     // only present for Plan event
+	Timestamp    string                `json:"timestamp"`
+}
+
+// WebhookEventStats is the state of the teardown at the time of the event.
+type WebhookEventStats struct {
+	TotalStackCount   int     `json:"total_stack_count"`
+	DeletedStackCount int     `json:"deleted_stack_count"`
+	ActiveStackCount  int     `json:"active_stack_count"`
+	StartedAt         string  `json:"started_at"`
+	UpdatedAt         string  `json:"updated_at"`
+	DurationInHours   float64 `json:"duration_in_hours"`
+}
+
+// WebhookEventStack is the stack an Error event is about. It is decoupled from the stack details so that
+// internal fields can change without breaking the consumers.
+type WebhookEventStack struct {
+	StackName             string                 `json:"stack_name"`
+	Region                string                 `json:"region"`
+	AccountID             string                 `json:"account_id,omitempty"` // only present for accounts listed in the accounts manifest
+	Status                string                 `json:"status"`
+	StatusReason          string                 `json:"status_reason"`
+	DeleteAttempt         int16                  `json:"delete_attempt"`
+	DeleteStartedAt       string                 `json:"delete_started_at"`
+	DeletionTimeInMinutes string                 `json:"deletion_time_in_minutes"`
+	ConsoleLink           string                 `json:"console_link"`
+	StackSetName          string                 `json:"stack_set_name,omitempty"` // only present for stacks managed by a StackSet
+	FailedResources       []WebhookEventResource `json:"failed_resources"`
+	RetainedResources     []WebhookEventResource `json:"retained_resources"`
+}
+
+// WebhookEventResource is a resource which failed to delete or was retained.
+type WebhookEventResource struct {
+	LogicalResourceID  string `json:"logical_resource_id"`
+	PhysicalResourceID string `json:"physical_resource_id"`
+	ResourceType       string `json:"resource_type"`
+	StatusReason       string `json:"status_reason"`
+	Cause              string `json:"cause"`
+}
+
+// WebhookEventProgress is the progress of the teardown since the last progress event.
+type WebhookEventProgress struct {
+	DeletedStacks          []string `json:"deleted_stacks"`
+	SlowestStack           string   `json:"slowest_stack"`
+	SlowestStackMinutes    string   `json:"slowest_stack_minutes"`
+	IntervalMinutes        float64  `json:"interval_minutes"`
+	EstimatedTimeRemaining string   `json:"estimated_time_remaining"`
+}
+
+// WebhookEventPlan is the plan of a dry run.
+type WebhookEventPlan struct {
+	StackCount     int        `json:"stack_count"`
+	Waves          [][]string `json:"waves"`
+	OutsidePattern []string   `json:"outside_pattern"`
+	Blockers       []string   `json:"blockers"`
+}
+
+// PlanAlert posts the plan of a dry run
+func (wn WebhookNotifier) PlanAlert(am AlertMessage) error {
+	plan := WebhookEventPlan{
+		StackCount:     am.Plan.StackCount,
+		Waves:          am.Plan.Waves,
+		OutsidePattern: am.Plan.OutsidePattern,
+		Blockers:       am.Plan.Blockers,
+	}
+	return wn.Alert(am, WebhookEvent{Event: "Plan", Title: "Stack Deletion Plan", Message: am.Message, Plan: &plan})
+}
+
+// StartAlert posts teardown start event
+func (wn WebhookNotifier) StartAlert(am AlertMessage) error {
+	return wn.Alert(am, WebhookEvent{Event: "Start", Title: "Stack Deletion Started", Message: am.Message})
+}
+
+// ProgressAlert posts teardown progress event
+func (wn WebhookNotifier) ProgressAlert(am AlertMessage) error {
+	progress := WebhookEventProgress{
+		DeletedStacks:          []string{},
+		SlowestStack:           am.Progress.SlowestStack.StackName,
+		SlowestStackMinutes:    am.Progress.SlowestStack.DeletionTimeInMinutes,
+		IntervalMinutes:        am.Progress.IntervalMinutes,
+		EstimatedTimeRemaining: am.Progress.EstimatedTimeRemaining,
+	}
+	for _, stack := range am.Progress.DeletedStacks {
+		progress.DeletedStacks = append(progress.DeletedStacks, stack.StackName)
+	}
+	return wn.Alert(am, WebhookEvent{Event: "Progress", Title: "Stack Deletion In Progress", Message: am.Message, Progress: &progress})
+}
+
+// ErrorAlert posts stack deletion error event
+func (wn WebhookNotifier) ErrorAlert(am AlertMessage) error {
+	event := WebhookEvent{Event: "Error", Title: "Stack Deletion Failed", Message: am.Message}
+	// errors like failing to list stacks are not specific to a stack
+	if am.FailedStack.StackName != "" {
+		event.FailedStack = webhookEventStack(am.FailedStack)
+	}
+	return wn.Alert(am, event)
+}
+
+// StuckAlert posts event when stack teardown is stuck
+func (wn WebhookNotifier) StuckAlert(am AlertMessage) error {
+	return wn.Alert(am, WebhookEvent{Event: "Stuck", Title: "Stack Deletion Stuck", Message: am.Message})
+}
+
+// SuccessAlert posts event for successful completion of stack teardown
+func (wn WebhookNotifier) SuccessAlert(am AlertMessage) error {
+	return wn.Alert(am, WebhookEvent{Event: "Complete", Title: "Stack Deletion Completed", Message: am.Message})
+}
+
+// webhookEventStack builds the payload of the failed stack
+func webhookEventStack(stack models.StackDetails) *WebhookEventStack {
+	return &WebhookEventStack{
+		StackName:             stack.StackName,
+		Region:                stack.Region,
+		AccountID:             stack.AccountID,
+		Status:                stack.Status,
+		StatusReason:          stack.StackStatusReason,
+		DeleteAttempt:         stack.DeleteAttempt,
+		DeleteStartedAt:       stack.DeleteStartedAt,
+		DeletionTimeInMinutes: stack.DeletionTimeInMinutes,
+		ConsoleLink:           stack.CFNConsoleLink,
+		StackSetName:          stack.StackSetName,
+		FailedResources:       webhookEventResources(stack.FailedResources),
+		RetainedResources:     webhookEventResources(stack.RetainedResources),
+	}
+}
+
+// webhookEventResources converts resources to payload, empty list is kept as [] instead of null
+func webhookEventResources(resources []models.FailedResource) []WebhookEventResource {
+	payload := []WebhookEventResource{}
+	for _, r := range resources {
+		payload = append(payload, WebhookEventResource{
+			LogicalResourceID:  r.LogicalResourceId,
+			PhysicalResourceID: r.PhysicalResourceId,
+			ResourceType:       r.ResourceType,
+			StatusReason:       r.StatusReason,
+			Cause:              r.Cause,
+		})
+	}
+	return payload
+}
+
+// Alert adds common fields to the event and posts it to the webhook url
+func (wn WebhookNotifier) Alert(am AlertMessage, event WebhookEvent) error {
+	ctx := am.Context
+	event.StackPattern = ctx.StackPattern
+	event.RunID = ctx.RunID
+	event.AccountID = ctx.AccountID
+	event.Region = ctx.Region
+	event.Timestamp = CurrentUTCDateTime()
+	event.Stats = WebhookEventStats{
+		TotalStackCount:   ctx.TotalStackCount,
+		DeletedStackCount: ctx.DeletedStackCount,
+		ActiveStackCount:  ctx.ActiveStackCount,
+		StartedAt:         ctx.StartedAt,
+		UpdatedAt:         ctx.UpdatedAt,
+		DurationInHours:   ctx.DurationInHours,
+	}
+	_, err := wn.Dispatcher.PostJSON("Webhook", wn.URL, event, nil)
+	return err
+}
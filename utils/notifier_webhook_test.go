@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func TestWebhookErrorAlertPayload(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	wn := WebhookNotifier{URL: server.URL, Dispatcher: NewNotificationDispatcher(time.Second, 1, "")}
+	err := wn.ErrorAlert(AlertMessage{
+		Message: "Failed to delete stack `qa-vpc`",
+		FailedStack: models.StackDetails{
+			StackName:             "qa-vpc",
+			Region:                "us-east-1",
+			Status:                "DELETE_FAILED",
+			StackStatusReason:     "The following resource(s) failed to delete: [VPC]",
+			DeleteAttempt:         2,
+			DeleteStartedAt:       "2021-02-07T04:02:11Z",
+			CFNConsoleLink:        "https://console.aws.amazon.com/cloudformation/home?region=us-east-1#/stacks/stackinfo?stackId=qa-vpc",
+			Exports:               []string{"qa-vpc-id"},
+			ActiveImporterStacks:  map[string]struct{}{"us-east-1/qa-app": {}},
+			FailedResources:       []models.FailedResource{{LogicalResourceId: "VPC", PhysicalResourceId: "vpc-1", ResourceType: "AWS::EC2::VPC", StatusReason: "has dependencies", Cause: models.DEPENDENCY_VIOLATION}},
+			DeletionTimeInMinutes: "",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"event", "title", "message", "stack_pattern", "run_id", "account_id", "region", "stats", "failed_stack", "timestamp"} {
+		if _, ok := event[field]; !ok {
+			t.Errorf("field %q missing from payload", field)
+		}
+	}
+
+	expected := `{"stack_name":"qa-vpc","region":"us-east-1","status":"DELETE_FAILED","status_reason":"The following resource(s) failed to delete: [VPC]",` +
+		`"delete_attempt":2,"delete_started_at":"2021-02-07T04:02:11Z","deletion_time_in_minutes":"",` +
+		`"console_link":"https://console.aws.amazon.com/cloudformation/home?region=us-east-1#/stacks/stackinfo?stackId=qa-vpc",` +
+		`"failed_resources":[{"logical_resource_id":"VPC","physical_resource_id":"vpc-1","resource_type":"AWS::EC2::VPC","status_reason":"has dependencies","cause":"DEPENDENCY_VIOLATION"}],` +
+		`"retained_resources":[]}`
+	if string(event["failed_stack"]) != expected {
+		t.Errorf("unexpected failed_stack payload\nexpected: %s\n     got: %s", expected, event["failed_stack"])
+	}
+}
+
+func TestWebhookErrorAlertWithoutStack(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	wn := WebhookNotifier{URL: server.URL, Dispatcher: NewNotificationDispatcher(time.Second, 1, "")}
+	if err := wn.ErrorAlert(AlertMessage{Message: "Unable to list stacks"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if string(event["failed_stack"]) != "null" {
+		t.Errorf("expected failed_stack to be null, got %s", event["failed_stack"])
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// PlanDetails describes what a teardown would do without deleting anything.
+type PlanDetails struct {
+	StackCount     int
+	Waves          [][]string // stacks deleted together in each cycle, in order of deletion
+	OutsidePattern []string   // stacks which don't match the pattern but are deleted as they import from matching stacks
+	Blockers       []string   // issues which would stop the teardown e.g. termination protection, StackSet instances and cyclic dependencies
+}
+
+// BuildPlan simulates the teardown on a copy of the dependency tree to find out the order of deletion and the blockers.
+func BuildPlan(dt map[string]models.StackDetails, cfn CFNManager, disableTerminationProtection, deleteStackSetInstances bool) PlanDetails {
+	plan := PlanDetails{}
+
+	// copying importers as they are removed while simulating deletion
+	remaining := map[string]map[string]struct{}{}
+	for stackName, stack := range dt {
+		if stack.Status == models.DELETE_COMPLETE {
+			continue
+		}
+		plan.StackCount++
+
+		importers := map[string]struct{}{}
+		for importer := range stack.ActiveImporterStacks {
+			if s, ok := dt[importer]; ok && s.Status == models.DELETE_COMPLETE {
+				continue
+			}
+			importers[importer] = struct{}{}
+		}
+		remaining[stackName] = importers
+
+		if !cfn.RegexMatch(stack.StackName) {
+			plan.OutsidePattern = append(plan.OutsidePattern, stackName)
+		}
+		if stack.TerminationProtection && !disableTerminationProtection {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("Termination protection is enabled for stack '%v'", stackName))
+		}
+		if stack.StackSetName != "" && !deleteStackSetInstances {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("Stack '%v' is managed by StackSet '%v'", stackName, stack.StackSetName))
+		}
+	}
+
+	for len(remaining) > 0 {
+		wave := []string{}
+		for stackName, importers := range remaining {
+			if len(importers) == 0 {
+				wave = append(wave, stackName)
+			}
+		}
+
+		// none of the remaining stacks can be deleted as they depend on each other
+		if len(wave) == 0 {
+			stuck := []string{}
+			for stackName := range remaining {
+				stuck = append(stuck, stackName)
+			}
+			sort.Strings(stuck)
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("Cyclic dependency or missing stacks block deletion of: %v", strings.Join(stuck, ", ")))
+			break
+		}
+
+		sort.Strings(wave)
+		for _, stackName := range wave {
+			delete(remaining, stackName)
+			for _, importers := range remaining {
+				delete(importers, stackName)
+			}
+		}
+		plan.Waves = append(plan.Waves, wave)
+	}
+
+	sort.Strings(plan.OutsidePattern)
+	sort.Strings(plan.Blockers)
+	return plan
+}
@@ -0,0 +1,342 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// PREFLIGHT_ALL_RESOURCES is the resource of actions which are not checked against a particular resource.
+const PREFLIGHT_ALL_RESOURCES = "*"
+
+// MissingPermission is an action needed for the teardown which the principal is not allowed to perform.
+type MissingPermission struct {
+	Principal string
+	Action    string
+	Resource  string
+	Decision  string   // implicitDeny or explicitDeny
+	Stacks    []string // stacks whose deletion needs the action
+}
+
+// PreflightReport lists permissions needed for the teardown which are missing.
+type PreflightReport struct {
+	Principals     []string // principals whose policies were simulated
+	CheckedActions int      // number of actions simulated across all principals and resources
+	Missing        []MissingPermission
+}
+
+// Blockers describes missing permissions as blockers of the plan.
+func (pr PreflightReport) Blockers() []string {
+	blockers := []string{}
+	for _, m := range pr.Missing {
+		blockers = append(blockers, fmt.Sprintf("'%v' is not allowed to perform '%v' on '%v' needed by stacks: %v", m.Principal, m.Action, m.Resource, strings.Join(m.Stacks, ", ")))
+	}
+	return blockers
+}
+
+// preflightCheck collects actions needed by a principal per resource along with the stacks needing them.
+type preflightCheck struct {
+	iam       IAMManager
+	principal string
+	partition string
+	account   string
+	actions   map[string]map[string][]string // resource -> action -> stack keys
+}
+
+// add records the actions needed on the resource for deletion of the stack.
+func (pc *preflightCheck) add(stackKey, resource string, actions ...string) {
+	if pc.actions[resource] == nil {
+		pc.actions[resource] = map[string][]string{}
+	}
+	for _, action := range actions {
+		stacks := pc.actions[resource][action]
+		if len(stacks) == 0 || stacks[len(stacks)-1] != stackKey {
+			pc.actions[resource][action] = append(stacks, stackKey)
+		}
+	}
+}
+
+// newPreflightCheck finds the principal of the manager and the account of its stacks. Nil is returned for the root user as it can't be denied any action.
+func newPreflightCheck(ctx context.Context, im IAMManager) (*preflightCheck, error) {
+	principal, err := im.PrincipalARN(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if principal == "" {
+		Logger.Warn("Skipping permission check of the root user")
+		return nil, nil
+	}
+	// arn:<partition>:iam::<account>:role/<name>
+	parts := strings.Split(principal, ":")
+	if len(parts) < 6 {
+		return nil, fmt.Errorf("Invalid principal ARN '%v'", principal)
+	}
+	// stacks can live in a different account than the principal e.g. accounts of the manifest deleted with the aws profile
+	account, err := im.AccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &preflightCheck{iam: im, principal: principal, partition: parts[1], account: account, actions: map[string]map[string][]string{}}, nil
+}
+
+// RunPreflight simulates IAM policies of the principals deleting the stacks for every action the teardown needs and reports the
+// ones which are not allowed, so that the teardown does not fail halfway. Principals are the caller or ROLE_ARN, roles of the
+// accounts manifest and the StackSet administrator role if stack instances are removed from StackSets.
+func RunPreflight(ctx context.Context, config models.Config, dt map[string]models.StackDetails, managers map[string]TargetManagers, stackSets StackSetManager) (PreflightReport, error) {
+	report := PreflightReport{}
+	checks := map[string]*preflightCheck{} // target key -> check
+	var stackSetCheck *preflightCheck
+	stackSetChecked := false
+
+	keys := []string{}
+	for key := range dt {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		stack := dt[key]
+		if stack.Status == models.DELETE_COMPLETE {
+			continue
+		}
+		targetKey := StackTarget(stack).Key()
+		m := managers[targetKey]
+		check, ok := checks[targetKey]
+		if !ok {
+			var err error
+			check, err = newPreflightCheck(ctx, m.IAM)
+			if err != nil {
+				return report, fmt.Errorf("Unable to find principal of target '%v': %v", targetKey, err)
+			}
+			checks[targetKey] = check
+		}
+
+		if stack.StackSetName != "" && config.DeleteStackSetInstances {
+			if !stackSetChecked {
+				stackSetChecked = true
+				var err error
+				stackSetCheck, err = newPreflightCheck(ctx, IAMManager{NukeRoleARN: stackSets.AdminRoleARN, AWSProfile: config.AWSProfile, AWSRegion: stackSets.AWSRegion, EndpointURL: stackSets.EndpointURL})
+				if err != nil {
+					return report, fmt.Errorf("Unable to find principal of StackSet administrator: %v", err)
+				}
+			}
+			if stackSetCheck != nil {
+				stackSetARN := fmt.Sprintf("arn:%v:cloudformation:%v:%v:stackset/%v:*", stackSetCheck.partition, stackSets.AWSRegion, stackSetCheck.account, stack.StackSetName)
+				stackSetCheck.add(key, stackSetARN, "cloudformation:ListStackInstances", "cloudformation:DeleteStackInstances", "cloudformation:DescribeStackSetOperation", "cloudformation:ListStackSetOperationResults")
+				if config.DeleteEmptyStackSets {
+					stackSetCheck.add(key, stackSetARN, "cloudformation:DeleteStackSet")
+				}
+			}
+		}
+		if check == nil {
+			continue
+		}
+
+		stackARN := fmt.Sprintf("arn:%v:cloudformation:%v:%v:stack/%v/*", check.partition, stack.Region, check.account, stack.StackName)
+		check.add(key, stackARN, "cloudformation:DescribeStacks", "cloudformation:DescribeStackEvents", "cloudformation:ListStackResources")
+		if stack.StackSetName != "" {
+			// stack instances are deleted by the StackSet execution role
+			continue
+		}
+		check.add(key, stackARN, "cloudformation:DeleteStack")
+		if stack.TerminationProtection && config.DisableTerminationProtection {
+			check.add(key, stackARN, "cloudformation:UpdateTerminationProtection")
+		}
+
+		resources, err := m.CFN.ListStackResources(ctx, stack.StackName)
+		if err != nil {
+			return report, fmt.Errorf("Unable to list resources of stack '%v': %v", key, err)
+		}
+		for _, r := range resources {
+			// resources without physical id were never created, so there is nothing to delete
+			if r.PhysicalResourceId == nil || r.ResourceType == nil {
+				continue
+			}
+			for resource, actions := range resourceActions(*r.ResourceType, *r.PhysicalResourceId, check.partition, stack.Region, check.account, stack.ServiceRoleARN != "") {
+				check.add(key, resource, actions...)
+			}
+		}
+	}
+
+	all := []*preflightCheck{}
+	for _, key := range sortedKeys(checks) {
+		if checks[key] != nil {
+			all = append(all, checks[key])
+		}
+	}
+	if stackSetCheck != nil {
+		all = append(all, stackSetCheck)
+	}
+
+	// the same principal can delete stacks of multiple targets
+	principals := map[string]struct{}{}
+	for _, check := range all {
+		if _, ok := principals[check.principal]; !ok {
+			principals[check.principal] = struct{}{}
+			report.Principals = append(report.Principals, check.principal)
+		}
+
+		resources := []string{}
+		for resource := range check.actions {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		for _, resource := range resources {
+			actions := []string{}
+			for action := range check.actions[resource] {
+				actions = append(actions, action)
+			}
+			sort.Strings(actions)
+			report.CheckedActions += len(actions)
+
+			denied, err := check.iam.SimulatePermissions(ctx, check.principal, resource, actions)
+			if err != nil {
+				return report, fmt.Errorf("Unable to simulate permissions of '%v': %v", check.principal, err)
+			}
+			for _, d := range denied {
+				report.Missing = append(report.Missing, MissingPermission{
+					Principal: check.principal,
+					Action:    d.Action,
+					Resource:  resource,
+					Decision:  d.Decision,
+					Stacks:    check.actions[resource][d.Action],
+				})
+			}
+		}
+	}
+	return report, nil
+}
+
+// sortedKeys returns keys of the preflight checks in order.
+func sortedKeys(checks map[string]*preflightCheck) []string {
+	keys := []string{}
+	for key := range checks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resourceDeleteActions lists actions needed by CloudFormation to delete resources of common types. They are checked on all resources
+// as physical ids of most resources are not ARNs. Resources of other types are not checked.
+var resourceDeleteActions = map[string][]string{
+	"AWS::ApiGateway::RestApi":                  {"apigateway:DELETE"},
+	"AWS::CertificateManager::Certificate":      {"acm:DeleteCertificate"},
+	"AWS::CloudFormation::Stack":                {"cloudformation:DeleteStack"},
+	"AWS::CloudFront::Distribution":             {"cloudfront:GetDistribution", "cloudfront:UpdateDistribution", "cloudfront:DeleteDistribution"},
+	"AWS::CloudWatch::Alarm":                    {"cloudwatch:DeleteAlarms"},
+	"AWS::DynamoDB::Table":                      {"dynamodb:DescribeTable", "dynamodb:DeleteTable"},
+	"AWS::EC2::EIP":                             {"ec2:ReleaseAddress"},
+	"AWS::EC2::Instance":                        {"ec2:TerminateInstances"},
+	"AWS::EC2::InternetGateway":                 {"ec2:DeleteInternetGateway"},
+	"AWS::EC2::NatGateway":                      {"ec2:DeleteNatGateway"},
+	"AWS::EC2::Route":                           {"ec2:DeleteRoute"},
+	"AWS::EC2::RouteTable":                      {"ec2:DeleteRouteTable"},
+	"AWS::EC2::SecurityGroup":                   {"ec2:DescribeSecurityGroups", "ec2:DeleteSecurityGroup"},
+	"AWS::EC2::Subnet":                          {"ec2:DeleteSubnet"},
+	"AWS::EC2::VPC":                             {"ec2:DeleteVpc"},
+	"AWS::EC2::VPCGatewayAttachment":            {"ec2:DetachInternetGateway"},
+	"AWS::ECS::Cluster":                         {"ecs:DeleteCluster"},
+	"AWS::ECS::Service":                         {"ecs:UpdateService", "ecs:DeleteService"},
+	"AWS::ECS::TaskDefinition":                  {"ecs:DeregisterTaskDefinition"},
+	"AWS::ElastiCache::ReplicationGroup":        {"elasticache:DeleteReplicationGroup"},
+	"AWS::ElasticLoadBalancingV2::Listener":     {"elasticloadbalancing:DeleteListener"},
+	"AWS::ElasticLoadBalancingV2::LoadBalancer": {"elasticloadbalancing:DeleteLoadBalancer"},
+	"AWS::ElasticLoadBalancingV2::TargetGroup":  {"elasticloadbalancing:DeleteTargetGroup"},
+	"AWS::Events::Rule":                         {"events:RemoveTargets", "events:DeleteRule"},
+	"AWS::IAM::InstanceProfile":                 {"iam:RemoveRoleFromInstanceProfile", "iam:DeleteInstanceProfile"},
+	"AWS::IAM::ManagedPolicy":                   {"iam:ListPolicyVersions", "iam:DeletePolicyVersion", "iam:DeletePolicy"},
+	"AWS::IAM::Policy":                          {"iam:DeleteRolePolicy", "iam:DeleteUserPolicy", "iam:DeleteGroupPolicy"},
+	"AWS::IAM::Role":                            {"iam:ListRolePolicies", "iam:ListAttachedRolePolicies", "iam:DeleteRolePolicy", "iam:DetachRolePolicy", "iam:DeleteRole"},
+	"AWS::IAM::User":                            {"iam:DeleteUser"},
+	"AWS::KMS::Alias":                           {"kms:DeleteAlias"},
+	"AWS::KMS::Key":                             {"kms:ScheduleKeyDeletion"},
+	"AWS::Kinesis::Stream":                      {"kinesis:DeleteStream"},
+	"AWS::Lambda::EventSourceMapping":           {"lambda:DeleteEventSourceMapping"},
+	"AWS::Lambda::Function":                     {"lambda:DeleteFunction"},
+	"AWS::Lambda::LayerVersion":                 {"lambda:DeleteLayerVersion"},
+	"AWS::Lambda::Permission":                   {"lambda:RemovePermission"},
+	"AWS::Logs::LogGroup":                       {"logs:DeleteLogGroup"},
+	"AWS::RDS::DBCluster":                       {"rds:DeleteDBCluster"},
+	"AWS::RDS::DBInstance":                      {"rds:DeleteDBInstance"},
+	"AWS::RDS::DBSubnetGroup":                   {"rds:DeleteDBSubnetGroup"},
+	"AWS::Route53::RecordSet":                   {"route53:ChangeResourceRecordSets"},
+	"AWS::S3::BucketPolicy":                     {"s3:DeleteBucketPolicy"},
+	"AWS::SNS::Subscription":                    {"sns:Unsubscribe"},
+	"AWS::SNS::Topic":                           {"sns:DeleteTopic"},
+	"AWS::SQS::Queue":                           {"sqs:DeleteQueue"},
+	"AWS::SSM::Parameter":                       {"ssm:DeleteParameter"},
+	"AWS::SecretsManager::Secret":               {"secretsmanager:DeleteSecret"},
+	"AWS::StepFunctions::StateMachine":          {"states:DeleteStateMachine"},
+}
+
+// resourceActions returns actions needed per resource ARN to delete a stack resource. Buckets, repositories and hosted zones are
+// emptied by cfn-teardown itself, so their actions are needed even if the stack has a service role which CloudFormation uses
+// to delete the resources instead of the caller's permissions.
+func resourceActions(resourceType, physicalID, partition, region, account string, serviceRole bool) map[string][]string {
+	actions := map[string][]string{}
+	switch resourceType {
+	case "AWS::S3::Bucket":
+		bucketARN := fmt.Sprintf("arn:%v:s3:::%v", partition, physicalID)
+		// all versions and delete markers are listed and deleted by their version id, also in unversioned buckets
+		actions[bucketARN] = []string{"s3:ListBucketVersions"}
+		actions[bucketARN+"/*"] = []string{"s3:DeleteObjectVersion"}
+		if !serviceRole {
+			actions[bucketARN] = append(actions[bucketARN], "s3:DeleteBucket")
+		}
+	case "AWS::ECR::Repository":
+		repositoryARN := fmt.Sprintf("arn:%v:ecr:%v:%v:repository/%v", partition, region, account, physicalID)
+		actions[repositoryARN] = []string{"ecr:ListImages", "ecr:BatchDeleteImage"}
+		if !serviceRole {
+			actions[repositoryARN] = append(actions[repositoryARN], "ecr:DeleteRepository")
+		}
+	case "AWS::Route53::HostedZone":
+		hostedZoneARN := fmt.Sprintf("arn:%v:route53:::hostedzone/%v", partition, physicalID)
+		actions[hostedZoneARN] = []string{"route53:GetHostedZone", "route53:ListResourceRecordSets", "route53:ChangeResourceRecordSets"}
+		if !serviceRole {
+			actions[hostedZoneARN] = append(actions[hostedZoneARN], "route53:DeleteHostedZone")
+		}
+	default:
+		if serviceRole {
+			break
+		}
+		if deleteActions, ok := resourceDeleteActions[resourceType]; ok {
+			actions[PREFLIGHT_ALL_RESOURCES] = deleteActions
+		} else {
+			Logger.Debug("Permissions of resource type are not checked", "resource_type", resourceType)
+		}
+	}
+	return actions
+}
+
+// printPreflight shows permissions missing for the teardown.
+func printPreflight(report PreflightReport) {
+	if len(report.Missing) == 0 {
+		Logger.Info("All permissions needed for the teardown are granted", "principals", strings.Join(report.Principals, ", "), "checked_actions", report.CheckedActions)
+		return
+	}
+	Logger.Error("Following permissions needed for the teardown are missing", "missing_count", len(report.Missing), "principals", strings.Join(report.Principals, ", "))
+	for _, m := range report.Missing {
+		Logger.Error(" - "+m.Action, "principal", m.Principal, "action", m.Action, "resource", m.Resource, "decision", m.Decision, "stacks", strings.Join(m.Stacks, ", "))
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func TestResourceActions(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType string
+		physicalID   string
+		serviceRole  bool
+		expected     map[string][]string
+	}{
+		{
+			name:         "bucket is emptied including versions and deleted",
+			resourceType: "AWS::S3::Bucket",
+			physicalID:   "qa-assets",
+			expected: map[string][]string{
+				"arn:aws:s3:::qa-assets":   {"s3:ListBucketVersions", "s3:DeleteBucket"},
+				"arn:aws:s3:::qa-assets/*": {"s3:DeleteObjectVersion"},
+			},
+		},
+		{
+			name:         "bucket of stack with service role is only emptied",
+			resourceType: "AWS::S3::Bucket",
+			physicalID:   "qa-assets",
+			serviceRole:  true,
+			expected: map[string][]string{
+				"arn:aws:s3:::qa-assets":   {"s3:ListBucketVersions"},
+				"arn:aws:s3:::qa-assets/*": {"s3:DeleteObjectVersion"},
+			},
+		},
+		{
+			name:         "repository is purged and deleted",
+			resourceType: "AWS::ECR::Repository",
+			physicalID:   "qa-app",
+			expected: map[string][]string{
+				"arn:aws:ecr:us-east-1:121212121212:repository/qa-app": {"ecr:ListImages", "ecr:BatchDeleteImage", "ecr:DeleteRepository"},
+			},
+		},
+		{
+			name:         "hosted zone of stack with service role is only emptied",
+			resourceType: "AWS::Route53::HostedZone",
+			physicalID:   "Z0123456789",
+			serviceRole:  true,
+			expected: map[string][]string{
+				"arn:aws:route53:::hostedzone/Z0123456789": {"route53:GetHostedZone", "route53:ListResourceRecordSets", "route53:ChangeResourceRecordSets"},
+			},
+		},
+		{
+			name:         "known resource type is checked on all resources",
+			resourceType: "AWS::DynamoDB::Table",
+			physicalID:   "qa-orders",
+			expected:     map[string][]string{PREFLIGHT_ALL_RESOURCES: {"dynamodb:DescribeTable", "dynamodb:DeleteTable"}},
+		},
+		{
+			name:         "resources of stack with service role are deleted by the role",
+			resourceType: "AWS::DynamoDB::Table",
+			physicalID:   "qa-orders",
+			serviceRole:  true,
+			expected:     map[string][]string{},
+		},
+		{
+			name:         "unknown resource type is not checked",
+			resourceType: "Custom::Seed",
+			physicalID:   "seed",
+			expected:     map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resourceActions(tt.resourceType, tt.physicalID, "aws", "us-east-1", "121212121212", tt.serviceRole)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// fakeIAMAccount serves STS, CloudFormation and IAM query api requests of accounts whose principals are denied the given actions
+type fakeIAMAccount struct {
+	callerARN       string
+	account         string
+	denied          map[string]string // action -> decision
+	deniedPrincipal string            // actions are only denied to this principal if set
+	resources       map[string]string // stack name -> bucket owned by the stack
+
+	mu        sync.Mutex
+	simulated []string // 'principal|resource|action' of simulated actions
+}
+
+func (f *fakeIAMAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch form.Get("Action") {
+	case "GetCallerIdentity":
+		fmt.Fprintf(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Arn>%v</Arn><UserId>AIDA</UserId><Account>%v</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`, f.callerARN, f.account)
+	case "AssumeRole":
+		io.WriteString(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>AKIDROLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>`+
+			`<SessionToken>token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+	case "ListStackResources":
+		io.WriteString(w, `<ListStackResourcesResponse><ListStackResourcesResult><StackResourceSummaries>`)
+		if bucket := f.resources[form.Get("StackName")]; bucket != "" {
+			fmt.Fprintf(w, `<member><LogicalResourceId>Bucket</LogicalResourceId><PhysicalResourceId>%v</PhysicalResourceId><ResourceType>AWS::S3::Bucket</ResourceType>`+
+				`<ResourceStatus>CREATE_COMPLETE</ResourceStatus><LastUpdatedTimestamp>2021-02-07T03:30:54Z</LastUpdatedTimestamp></member>`, bucket)
+		}
+		// resources which were never created have no physical id
+		io.WriteString(w, `<member><LogicalResourceId>Skipped</LogicalResourceId><ResourceType>AWS::SNS::Topic</ResourceType><ResourceStatus>CREATE_FAILED</ResourceStatus>`+
+			`<LastUpdatedTimestamp>2021-02-07T03:30:54Z</LastUpdatedTimestamp></member>`)
+		io.WriteString(w, `</StackResourceSummaries></ListStackResourcesResult></ListStackResourcesResponse>`)
+	case "SimulatePrincipalPolicy":
+		resource := form.Get("ResourceArns.member.1")
+		io.WriteString(w, `<SimulatePrincipalPolicyResponse><SimulatePrincipalPolicyResult><IsTruncated>false</IsTruncated><EvaluationResults>`)
+		for i := 1; form.Has(fmt.Sprintf("ActionNames.member.%v", i)); i++ {
+			action := form.Get(fmt.Sprintf("ActionNames.member.%v", i))
+			f.simulated = append(f.simulated, form.Get("PolicySourceArn")+"|"+resource+"|"+action)
+			decision := "allowed"
+			if d, ok := f.denied[action]; ok && (f.deniedPrincipal == "" || f.deniedPrincipal == form.Get("PolicySourceArn")) {
+				decision = d
+			}
+			fmt.Fprintf(w, `<member><EvalActionName>%v</EvalActionName><EvalResourceName>%v</EvalResourceName><EvalDecision>%v</EvalDecision></member>`, action, resource, decision)
+		}
+		io.WriteString(w, `</EvaluationResults></SimulatePrincipalPolicyResult></SimulatePrincipalPolicyResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidAction</Code><Message>unexpected action %v</Message></Error></ErrorResponse>`, form.Get("Action"))
+	}
+}
+
+func TestSimulatePermissionsReturnsDeniedActions(t *testing.T) {
+	fake := &fakeIAMAccount{denied: map[string]string{"s3:DeleteObjectVersion": "implicitDeny", "s3:DeleteBucket": "explicitDeny"}}
+	im := IAMManager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	denied, err := im.SimulatePermissions(context.Background(), "arn:aws:iam::121212121212:user/ci", "arn:aws:s3:::qa-assets", []string{"s3:DeleteBucket", "s3:DeleteObjectVersion", "s3:ListBucketVersions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DeniedAction{
+		{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::qa-assets", Decision: "explicitDeny"},
+		{Action: "s3:DeleteObjectVersion", Resource: "arn:aws:s3:::qa-assets", Decision: "implicitDeny"},
+	}
+	if !reflect.DeepEqual(denied, expected) {
+		t.Errorf("expected %v, got %v", expected, denied)
+	}
+}
+
+func TestRunPreflightReportsDeniedActions(t *testing.T) {
+	fake := &fakeIAMAccount{
+		callerARN: "arn:aws:iam::121212121212:user/ci",
+		account:   "121212121212",
+		denied:    map[string]string{"s3:DeleteObjectVersion": "implicitDeny"},
+		resources: map[string]string{"qa-assets": "qa-assets-bucket", "qa-media": "qa-media-bucket"},
+	}
+	config := models.Config{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+	target := Target{Region: "us-east-1"}
+	managers := map[string]TargetManagers{target.Key(): NewTargetManagers(config, target)}
+	dt := map[string]models.StackDetails{
+		"us-east-1/qa-assets": {StackName: "qa-assets", Region: "us-east-1"},
+		"us-east-1/qa-media":  {StackName: "qa-media", Region: "us-east-1"},
+		"us-east-1/qa-old":    {StackName: "qa-old", Region: "us-east-1", Status: models.DELETE_COMPLETE},
+	}
+
+	report, err := RunPreflight(context.Background(), config, dt, managers, StackSetManager{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Principals, []string{"arn:aws:iam::121212121212:user/ci"}) {
+		t.Errorf("unexpected principals %v", report.Principals)
+	}
+	// 4 stack actions per stack and 2 bucket actions per bucket
+	if report.CheckedActions != 14 {
+		t.Errorf("expected 14 checked actions, got %v", report.CheckedActions)
+	}
+	expected := []MissingPermission{
+		{Principal: "arn:aws:iam::121212121212:user/ci", Action: "s3:DeleteObjectVersion", Resource: "arn:aws:s3:::qa-assets-bucket/*", Decision: "implicitDeny", Stacks: []string{"us-east-1/qa-assets"}},
+		{Principal: "arn:aws:iam::121212121212:user/ci", Action: "s3:DeleteObjectVersion", Resource: "arn:aws:s3:::qa-media-bucket/*", Decision: "implicitDeny", Stacks: []string{"us-east-1/qa-media"}},
+	}
+	if !reflect.DeepEqual(report.Missing, expected) {
+		t.Errorf("expected missing permissions %+v, got %+v", expected, report.Missing)
+	}
+
+	blockers := report.Blockers()
+	if len(blockers) != 2 || blockers[0] != "'arn:aws:iam::121212121212:user/ci' is not allowed to perform 's3:DeleteObjectVersion' on 'arn:aws:s3:::qa-assets-bucket/*' needed by stacks: us-east-1/qa-assets" {
+		t.Errorf("unexpected blockers %v", blockers)
+	}
+	for _, s := range fake.simulated {
+		if strings.Contains(s, "qa-old") {
+			t.Errorf("expected deleted stack not to be checked, got %v", s)
+		}
+	}
+}
+
+func TestRunPreflightChecksEachTargetWithItsOwnPrincipal(t *testing.T) {
+	role := "arn:aws:iam::222222222222:role/teardown"
+	fake := &fakeIAMAccount{
+		callerARN:       "arn:aws:iam::121212121212:user/ci",
+		account:         "121212121212",
+		denied:          map[string]string{"cloudformation:DeleteStack": "implicitDeny"},
+		deniedPrincipal: role,
+		resources:       map[string]string{},
+	}
+	config := models.Config{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+	// stacks of the account without role are deleted with the aws profile
+	withRole := Target{AccountID: "222222222222", RoleARN: role, Region: "us-east-1"}
+	withProfile := Target{AccountID: "333333333333", Region: "eu-west-1"}
+	managers := map[string]TargetManagers{
+		withRole.Key():    NewTargetManagers(config, withRole),
+		withProfile.Key(): NewTargetManagers(config, withProfile),
+	}
+	dt := map[string]models.StackDetails{
+		withRole.StackKey("qa-app"):    {StackName: "qa-app", AccountID: "222222222222", Region: "us-east-1"},
+		withProfile.StackKey("qa-vpc"): {StackName: "qa-vpc", AccountID: "333333333333", Region: "eu-west-1"},
+	}
+
+	report, err := RunPreflight(context.Background(), config, dt, managers, StackSetManager{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Principals, []string{role, "arn:aws:iam::121212121212:user/ci"}) {
+		t.Errorf("unexpected principals %v", report.Principals)
+	}
+	for _, expected := range []string{
+		role + "|arn:aws:cloudformation:us-east-1:222222222222:stack/qa-app/*|cloudformation:DeleteStack",
+		"arn:aws:iam::121212121212:user/ci|arn:aws:cloudformation:eu-west-1:333333333333:stack/qa-vpc/*|cloudformation:DeleteStack",
+	} {
+		found := false
+		for _, s := range fake.simulated {
+			found = found || s == expected
+		}
+		if !found {
+			t.Errorf("expected '%v' to be simulated, got %v", expected, fake.simulated)
+		}
+	}
+	expected := []MissingPermission{
+		{Principal: role, Action: "cloudformation:DeleteStack", Resource: "arn:aws:cloudformation:us-east-1:222222222222:stack/qa-app/*", Decision: "implicitDeny", Stacks: []string{withRole.StackKey("qa-app")}},
+	}
+	if !reflect.DeepEqual(report.Missing, expected) {
+		t.Errorf("expected missing permissions %+v, got %+v", expected, report.Missing)
+	}
+}
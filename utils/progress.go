@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// ProgressDetails summarises the teardown progress since the last progress alert.
+type ProgressDetails struct {
+	DeletedStacks          []models.StackDetails // stacks deleted since the last progress alert
+	SlowestStack           models.StackDetails   // stack which took the longest to delete among the deleted stacks
+	IntervalMinutes        float64               // minutes since the last progress alert
+	EstimatedTimeRemaining string                // based on deletion rate so far e.g. 1h20m0s, empty if unknown
+}
+
+// ProgressTracker decides when a progress alert is due.
+// An alert is due after every N deleted stacks or every M minutes whichever comes first,
+// but never more often than the min gap so that channels are not spammed.
+type ProgressTracker struct {
+	EveryStacks int           // 0 disables stack count based alerts
+	Interval    time.Duration // 0 disables time based alerts
+	MinGap      time.Duration
+
+	deletionStartedAt time.Time
+	lastAlertAt       time.Time
+	totalDeleted      int
+	deletedSince      []models.StackDetails
+}
+
+// Enabled reports whether any kind of progress alert is configured.
+func (pt *ProgressTracker) Enabled() bool {
+	return pt.EveryStacks > 0 || pt.Interval > 0
+}
+
+// Start marks the start of deletion which is used to estimate remaining time.
+func (pt *ProgressTracker) Start(now time.Time) {
+	pt.deletionStartedAt = now
+	pt.lastAlertAt = now
+}
+
+// StackDeleted records a deleted stack for the next progress alert.
+func (pt *ProgressTracker) StackDeleted(stack models.StackDetails) {
+	pt.totalDeleted++
+	pt.deletedSince = append(pt.deletedSince, stack)
+}
+
+// Due checks if a progress alert should be sent now.
+func (pt *ProgressTracker) Due(now time.Time) bool {
+	if !pt.Enabled() {
+		return false
+	}
+	sinceLast := now.Sub(pt.lastAlertAt)
+	if sinceLast < pt.MinGap {
+		return false
+	}
+	if pt.EveryStacks > 0 && len(pt.deletedSince) >= pt.EveryStacks {
+		return true
+	}
+	return pt.Interval > 0 && sinceLast >= pt.Interval
+}
+
+// Flush summarises progress since the last alert and resets the interval.
+func (pt *ProgressTracker) Flush(now time.Time, remainingStacks int) ProgressDetails {
+	pd := ProgressDetails{
+		DeletedStacks:   pt.deletedSince,
+		IntervalMinutes: now.Sub(pt.lastAlertAt).Minutes(),
+	}
+
+	slowest := -1.0
+	for _, stack := range pt.deletedSince {
+		minutes, err := strconv.ParseFloat(stack.DeletionTimeInMinutes, 64)
+		if err == nil && minutes > slowest {
+			slowest = minutes
+			pd.SlowestStack = stack
+		}
+	}
+
+	if pt.totalDeleted > 0 && remainingStacks > 0 {
+		perStack := now.Sub(pt.deletionStartedAt) / time.Duration(pt.totalDeleted)
+		pd.EstimatedTimeRemaining = (perStack * time.Duration(remainingStacks)).Round(time.Minute).String()
+	}
+
+	pt.lastAlertAt = now
+	pt.deletedSince = nil
+	return pd
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// RegionOrder declares that all stacks of a region must be deleted before any stack of another region is deleted.
+type RegionOrder struct {
+	Before string
+	After  string
+}
+
+// ParseRegions returns comma separated regions of AWS_REGIONS or AWS_REGION if AWS_REGIONS is empty.
+func ParseRegions(regions, region string) []string {
+	parsed := []string{}
+	seen := map[string]struct{}{}
+	for _, r := range strings.Split(regions, ",") {
+		r = strings.TrimSpace(r)
+		if _, ok := seen[r]; ok || r == "" {
+			continue
+		}
+		seen[r] = struct{}{}
+		parsed = append(parsed, r)
+	}
+	if len(parsed) == 0 && region != "" {
+		parsed = append(parsed, region)
+	}
+	return parsed
+}
+
+// ParseRegionOrder parses comma separated ordering constraints e.g. 'eu-west-1>us-east-1' which deletes eu-west-1 stacks before us-east-1 stacks.
+// Constraints can be chained e.g. 'eu-west-1>eu-central-1>us-east-1'.
+func ParseRegionOrder(value string, regions []string) ([]RegionOrder, error) {
+	known := map[string]struct{}{}
+	for _, r := range regions {
+		known[r] = struct{}{}
+	}
+
+	orders := []RegionOrder{}
+	for _, constraint := range strings.Split(value, ",") {
+		if strings.TrimSpace(constraint) == "" {
+			continue
+		}
+		chain := strings.Split(constraint, ">")
+		if len(chain) < 2 {
+			return nil, fmt.Errorf("Invalid region order '%v'. Expected format: 'eu-west-1>us-east-1'", constraint)
+		}
+		for i := range chain {
+			chain[i] = strings.TrimSpace(chain[i])
+			if _, ok := known[chain[i]]; !ok {
+				return nil, fmt.Errorf("Region '%v' in region order '%v' is not one of the regions: %v", chain[i], constraint, strings.Join(regions, ", "))
+			}
+		}
+		for i := 0; i < len(chain)-1; i++ {
+			if chain[i] == chain[i+1] {
+				return nil, fmt.Errorf("Invalid region order '%v'. A region can't be deleted before itself", constraint)
+			}
+			orders = append(orders, RegionOrder{Before: chain[i], After: chain[i+1]})
+		}
+	}
+	return orders, nil
+}
+
+// AddRegionOrderEdges makes every stack of the region deleted later depend on every stack of the region deleted first.
+// Stacks of the first region are added as importers so that the ordering is respected like any other dependency.
+func AddRegionOrderEdges(dt map[string]models.StackDetails, orders []RegionOrder) map[string]models.StackDetails {
+	for _, order := range orders {
+		before := []string{}
+		for key, stack := range dt {
+			if stack.Region == order.Before && stack.Status != models.DELETE_COMPLETE {
+				before = append(before, key)
+			}
+		}
+		if len(before) == 0 {
+			continue
+		}
+
+		for key, stack := range dt {
+			if stack.Region != order.After {
+				continue
+			}
+			if stack.ActiveImporterStacks == nil {
+				stack.ActiveImporterStacks = map[string]struct{}{}
+			}
+			for _, b := range before {
+				stack.ActiveImporterStacks[b] = struct{}{}
+			}
+			dt[key] = stack
+		}
+	}
+	return dt
+}
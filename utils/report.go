@@ -0,0 +1,372 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// REPORT_FORMATS lists supported report formats and their file names.
+var REPORT_FORMATS = map[string]string{
+	"markdown": "teardown_report.md",
+	"json":     "teardown_report.json",
+	"junit":    "teardown_report.xml",
+}
+
+// Outcome of a stack in the report
+var (
+	STACK_DELETED_OUTCOME     = "Deleted"
+	STACK_FAILED_OUTCOME      = "Failed"
+	STACK_NOT_DELETED_OUTCOME = "NotDeleted" // run stopped before the stack could be deleted
+)
+
+// ReportDetails is the final report of a teardown run.
+type ReportDetails struct {
+	RunID             string        `json:"run_id"`
+	Status            string        `json:"status"` // Succeeded | Failed | Stuck
+	Message           string        `json:"message"`
+	StackPattern      string        `json:"stack_pattern"`
+	AccountID         string        `json:"account_id"`
+	Region            string        `json:"region"`
+	StartedAt         string        `json:"started_at"`
+	CompletedAt       string        `json:"completed_at"`
+	Duration          string        `json:"duration"`
+	TotalStackCount   int           `json:"total_stack_count"`
+	DeletedStackCount int           `json:"deleted_stack_count"`
+	FailedStackCount  int           `json:"failed_stack_count"`
+	Stacks            []ReportStack `json:"stacks"`
+	generatedAt       time.Time     // used for junit timestamp
+	durationSeconds   float64       // used for junit time
+}
+
+// ReportStack is the outcome of a single stack in the report.
+type ReportStack struct {
+	StackName             string                  `json:"stack_name"`
+	Region                string                  `json:"region"`
+	AccountID             string                  `json:"account_id,omitempty"` // only present for accounts listed in the accounts manifest
+	Outcome               string                  `json:"outcome"`              // Deleted | Failed | NotDeleted
+	Status                string                  `json:"status"`
+	StatusReason          string                  `json:"status_reason"`
+	DeleteAttempt         int16                   `json:"delete_attempt"`
+	DeletionTimeInMinutes string                  `json:"deletion_time_in_minutes"`
+	CFNConsoleLink        string                  `json:"console_link"`
+	FailedResources       []models.FailedResource `json:"failed_resources"`
+	RetainedResources     []models.FailedResource `json:"retained_resources"`
+}
+
+// Target is the region of the stack, prefixed with account id for accounts listed in the accounts manifest.
+func (s ReportStack) Target() string {
+	return Target{AccountID: s.AccountID, Region: s.Region}.Key()
+}
+
+// ParseReportFormats validates comma separated report formats.
+func ParseReportFormats(value string) ([]string, error) {
+	formats := []string{}
+	for _, f := range strings.Split(value, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if _, ok := REPORT_FORMATS[f]; !ok {
+			return nil, fmt.Errorf("Invalid report format '%v'. Supported formats: markdown, json, junit", f)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// NewReport prepares the final report from the dependency tree and the teardown stats.
+func NewReport(dt map[string]models.StackDetails, status, message, stackPattern, accountID, region string) ReportDetails {
+	now := time.Now().UTC()
+	duration := time.Duration(NUKE_DURATION_IN_HRS * float64(time.Hour)).Round(time.Second)
+	report := ReportDetails{
+		RunID:           RUN_ID,
+		Status:          status,
+		Message:         message,
+		StackPattern:    stackPattern,
+		AccountID:       accountID,
+		Region:          region,
+		StartedAt:       NUKE_START_TIME,
+		CompletedAt:     NUKE_END_TIME,
+		Duration:        duration.String(),
+		TotalStackCount: TOTAL_STACK_COUNT,
+		Stacks:          []ReportStack{},
+		generatedAt:     now,
+		durationSeconds: duration.Seconds(),
+	}
+
+	for _, stack := range dt {
+		rs := ReportStack{
+			StackName:             stack.StackName,
+			Region:                stack.Region,
+			AccountID:             stack.AccountID,
+			Outcome:               stackOutcome(stack),
+			Status:                stack.Status,
+			StatusReason:          stack.StackStatusReason,
+			DeleteAttempt:         stack.DeleteAttempt,
+			DeletionTimeInMinutes: stack.DeletionTimeInMinutes,
+			CFNConsoleLink:        stack.CFNConsoleLink,
+			FailedResources:       stack.FailedResources,
+			RetainedResources:     stack.RetainedResources,
+		}
+		switch rs.Outcome {
+		case STACK_DELETED_OUTCOME:
+			report.DeletedStackCount++
+		case STACK_FAILED_OUTCOME:
+			report.FailedStackCount++
+		}
+		report.Stacks = append(report.Stacks, rs)
+	}
+
+	// failed stacks first, then the ones which were not deleted so that the actionable ones are on top
+	order := map[string]int{STACK_FAILED_OUTCOME: 0, STACK_NOT_DELETED_OUTCOME: 1, STACK_DELETED_OUTCOME: 2}
+	sort.Slice(report.Stacks, func(i, j int) bool {
+		a, b := report.Stacks[i], report.Stacks[j]
+		if order[a.Outcome] != order[b.Outcome] {
+			return order[a.Outcome] < order[b.Outcome]
+		}
+		if a.StackName != b.StackName {
+			return a.StackName < b.StackName
+		}
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		return a.Region < b.Region
+	})
+	return report
+}
+
+// stackOutcome marks a stack as failed if it is in DELETE_FAILED state or the teardown stopped due to an error with the stack
+// e.g. failure to empty a bucket. Status reason is only set by the teardown on such errors.
+func stackOutcome(stack models.StackDetails) string {
+	if stack.Status == models.DELETE_COMPLETE {
+		return STACK_DELETED_OUTCOME
+	}
+	if stack.Status == models.DELETE_FAILED || stack.StackStatusReason != "" {
+		return STACK_FAILED_OUTCOME
+	}
+	return STACK_NOT_DELETED_OUTCOME
+}
+
+// WriteReports writes the report in given formats to the directory.
+// Markdown report is also appended to GitHub step summary when running in GitHub Actions.
+func WriteReports(report ReportDetails, formats []string, dir string) error {
+	for _, format := range formats {
+		var content []byte
+		var err error
+		switch format {
+		case "markdown":
+			content = []byte(report.Markdown())
+		case "json":
+			content, err = json.MarshalIndent(report, "", " ")
+		case "junit":
+			content, err = report.JUnit()
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to generate %v report: %v", format, err)
+		}
+
+		file := filepath.Join(dir, REPORT_FORMATS[format])
+		if err = os.WriteFile(file, content, 0644); err != nil {
+			return fmt.Errorf("Unable to write %v report: %v", format, err)
+		}
+		Logger.Info("Report written", "format", format, "file", file)
+
+		if format == "markdown" {
+			if summary := os.Getenv("GITHUB_STEP_SUMMARY"); summary != "" {
+				if err = appendToFile(summary, content); err != nil {
+					return fmt.Errorf("Unable to write GitHub step summary: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Markdown renders the report as a summary table followed by stack details.
+func (r ReportDetails) Markdown() string {
+	icon := map[string]string{RUN_SUCCEEDED: "✅", RUN_FAILED: "❌", RUN_STUCK: "⚠️"}
+	stackIcon := map[string]string{STACK_DELETED_OUTCOME: "✅", STACK_FAILED_OUTCOME: "❌", STACK_NOT_DELETED_OUTCOME: "⏸️"}
+
+	var md strings.Builder
+	fmt.Fprintf(&md, "## %v Stack Teardown %v\n\n", icon[r.Status], r.Status)
+	if r.Message != "" {
+		fmt.Fprintf(&md, "%v\n\n", r.Message)
+	}
+	md.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&md, "| Stack Pattern | `%v` |\n", r.StackPattern)
+	fmt.Fprintf(&md, "| Account | %v |\n", r.AccountID)
+	fmt.Fprintf(&md, "| Region | %v |\n", r.Region)
+	fmt.Fprintf(&md, "| Stacks Deleted | %v/%v |\n", r.DeletedStackCount, r.TotalStackCount)
+	fmt.Fprintf(&md, "| Stacks Failed | %v |\n", r.FailedStackCount)
+	fmt.Fprintf(&md, "| Started At | %v |\n", r.StartedAt)
+	fmt.Fprintf(&md, "| Completed At | %v |\n", r.CompletedAt)
+	fmt.Fprintf(&md, "| Duration | %v |\n", r.Duration)
+	fmt.Fprintf(&md, "| Run ID | %v |\n", r.RunID)
+
+	if len(r.Stacks) > 0 {
+		md.WriteString("\n### Stacks\n\n")
+		md.WriteString("| | Stack | Region | Status | Attempts | Minutes | Reason |\n|---|---|---|---|---|---|---|\n")
+		for _, s := range r.Stacks {
+			fmt.Fprintf(&md, "| %v | [%v](%v) | %v | %v | %v | %v | %v |\n", stackIcon[s.Outcome], s.StackName, s.CFNConsoleLink, s.Target(), s.Status, s.DeleteAttempt, s.DeletionTimeInMinutes, markdownCell(s.StatusReason))
+		}
+	}
+
+	for _, s := range r.Stacks {
+		if len(s.FailedResources) == 0 && len(s.RetainedResources) == 0 {
+			continue
+		}
+		fmt.Fprintf(&md, "\n### %v (%v)\n\n", s.StackName, s.Target())
+		md.WriteString("| Resource | Type | Physical Id | Cause | Reason |\n|---|---|---|---|---|\n")
+		for _, res := range s.FailedResources {
+			fmt.Fprintf(&md, "| `%v` | %v | %v | %v | %v |\n", res.LogicalResourceId, res.ResourceType, res.PhysicalResourceId, res.Cause, markdownCell(res.StatusReason))
+		}
+		for _, res := range s.RetainedResources {
+			fmt.Fprintf(&md, "| `%v` | %v | %v | RETAINED | %v |\n", res.LogicalResourceId, res.ResourceType, res.PhysicalResourceId, markdownCell(res.StatusReason))
+		}
+	}
+	return md.String()
+}
+
+// markdownCell escapes text so that it doesn't break the table or get rendered as html
+func markdownCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// JUnitTestSuites is the root element of JUnit XML report.
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite groups stacks of a run.
+type JUnitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []JUnitProperty `xml:"properties>property"`
+	TestCases  []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitProperty is a key value pair describing the run.
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnitTestCase is a stack. It passes if the stack is deleted.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+}
+
+// JUnitFailure describes why a stack could not be deleted.
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// JUnitSkipped marks stacks which were not deleted as the run stopped earlier.
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// JUnit renders the report as JUnit XML where every stack is a test case.
+func (r ReportDetails) JUnit() ([]byte, error) {
+	suite := JUnitTestSuite{
+		Name:      "cfn-teardown " + r.StackPattern,
+		Time:      fmt.Sprintf("%.3f", r.durationSeconds),
+		Timestamp: r.generatedAt.Format("2006-01-02T15:04:05"),
+		Properties: []JUnitProperty{
+			{Name: "run_id", Value: r.RunID},
+			{Name: "status", Value: r.Status},
+			{Name: "account_id", Value: r.AccountID},
+			{Name: "region", Value: r.Region},
+		},
+		TestCases: []JUnitTestCase{},
+	}
+
+	for _, s := range r.Stacks {
+		tc := JUnitTestCase{Name: s.StackName, ClassName: "cfn-teardown." + strings.ReplaceAll(s.Target(), "/", "."), Time: "0.000"}
+		if minutes, err := strconv.ParseFloat(s.DeletionTimeInMinutes, 64); err == nil {
+			tc.Time = fmt.Sprintf("%.3f", minutes*60)
+		}
+
+		switch s.Outcome {
+		case STACK_FAILED_OUTCOME:
+			details := []string{}
+			for _, res := range s.FailedResources {
+				details = append(details, fmt.Sprintf("%v (%v) %v | Cause: %v | Reason: %v", res.LogicalResourceId, res.ResourceType, res.PhysicalResourceId, res.Cause, res.StatusReason))
+			}
+			tc.Failure = &JUnitFailure{Message: s.StatusReason, Type: s.Status, Details: strings.Join(details, "\n")}
+			suite.Failures++
+		case STACK_NOT_DELETED_OUTCOME:
+			tc.Skipped = &JUnitSkipped{Message: fmt.Sprintf("Stack was not deleted as the run stopped. Status: %v", s.Status)}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	suites := JUnitTestSuites{
+		Name:     "cfn-teardown",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []JUnitTestSuite{suite},
+	}
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// appendToFile appends content to the file creating it if necessary
+func appendToFile(file string, content []byte) error {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(content)
+	return err
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+func testReport() ReportDetails {
+	return ReportDetails{
+		RunID:             "20210207T033054Z-3f9a",
+		Status:            RUN_FAILED,
+		Message:           "Failed to delete stack `qa-vpc`",
+		StackPattern:      "^qa-",
+		AccountID:         "121212121212",
+		Region:            "us-east-1",
+		StartedAt:         "2021-02-07T03:30:54Z",
+		CompletedAt:       "2021-02-07T04:10:21Z",
+		Duration:          "39m27s",
+		TotalStackCount:   3,
+		DeletedStackCount: 1,
+		FailedStackCount:  1,
+		Stacks: []ReportStack{
+			{
+				StackName: "qa-vpc", Region: "us-east-1", Outcome: STACK_FAILED_OUTCOME, Status: models.DELETE_FAILED,
+				StatusReason: "The following resource(s) failed to delete: [VPC]", DeleteAttempt: 2, CFNConsoleLink: "https://console/qa-vpc",
+				FailedResources:   []models.FailedResource{{LogicalResourceId: "VPC", PhysicalResourceId: "vpc-1", ResourceType: "AWS::EC2::VPC", StatusReason: "has | dependencies", Cause: models.DEPENDENCY_VIOLATION}},
+				RetainedResources: []models.FailedResource{{LogicalResourceId: "Logs", PhysicalResourceId: "qa-logs", ResourceType: "AWS::S3::Bucket", StatusReason: "<retained>"}},
+			},
+			{StackName: "qa-db", Region: "eu-west-1", AccountID: "343434343434", Outcome: STACK_NOT_DELETED_OUTCOME, Status: "CREATE_COMPLETE", CFNConsoleLink: "https://console/qa-db"},
+			{StackName: "qa-app", Region: "us-east-1", Outcome: STACK_DELETED_OUTCOME, Status: models.DELETE_COMPLETE, DeleteAttempt: 1, DeletionTimeInMinutes: "2.5", CFNConsoleLink: "https://console/qa-app"},
+		},
+		generatedAt:     time.Date(2021, 2, 7, 4, 10, 21, 0, time.UTC),
+		durationSeconds: 2367,
+	}
+}
+
+func TestReportMarkdown(t *testing.T) {
+	expected := "## ❌ Stack Teardown Failed\n\n" +
+		"Failed to delete stack `qa-vpc`\n\n" +
+		"| | |\n|---|---|\n" +
+		"| Stack Pattern | `^qa-` |\n" +
+		"| Account | 121212121212 |\n" +
+		"| Region | us-east-1 |\n" +
+		"| Stacks Deleted | 1/3 |\n" +
+		"| Stacks Failed | 1 |\n" +
+		"| Started At | 2021-02-07T03:30:54Z |\n" +
+		"| Completed At | 2021-02-07T04:10:21Z |\n" +
+		"| Duration | 39m27s |\n" +
+		"| Run ID | 20210207T033054Z-3f9a |\n" +
+		"\n### Stacks\n\n" +
+		"| | Stack | Region | Status | Attempts | Minutes | Reason |\n|---|---|---|---|---|---|---|\n" +
+		"| ❌ | [qa-vpc](https://console/qa-vpc) | us-east-1 | DELETE_FAILED | 2 |  | The following resource(s) failed to delete: [VPC] |\n" +
+		"| ⏸️ | [qa-db](https://console/qa-db) | 343434343434/eu-west-1 | CREATE_COMPLETE | 0 |  |  |\n" +
+		"| ✅ | [qa-app](https://console/qa-app) | us-east-1 | DELETE_COMPLETE | 1 | 2.5 |  |\n" +
+		"\n### qa-vpc (us-east-1)\n\n" +
+		"| Resource | Type | Physical Id | Cause | Reason |\n|---|---|---|---|---|\n" +
+		"| `VPC` | AWS::EC2::VPC | vpc-1 | DEPENDENCY_VIOLATION | has \\| dependencies |\n" +
+		"| `Logs` | AWS::S3::Bucket | qa-logs | RETAINED | &lt;retained&gt; |\n"
+
+	if got := testReport().Markdown(); got != expected {
+		t.Errorf("unexpected markdown report\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="cfn-teardown" tests="3" failures="1" skipped="1" time="2367.000">
+  <testsuite name="cfn-teardown ^qa-" tests="3" failures="1" skipped="1" time="2367.000" timestamp="2021-02-07T04:10:21">
+    <properties>
+      <property name="run_id" value="20210207T033054Z-3f9a"></property>
+      <property name="status" value="Failed"></property>
+      <property name="account_id" value="121212121212"></property>
+      <property name="region" value="us-east-1"></property>
+    </properties>
+    <testcase name="qa-vpc" classname="cfn-teardown.us-east-1" time="0.000">
+      <failure message="The following resource(s) failed to delete: [VPC]" type="DELETE_FAILED">VPC (AWS::EC2::VPC) vpc-1 | Cause: DEPENDENCY_VIOLATION | Reason: has | dependencies</failure>
+    </testcase>
+    <testcase name="qa-db" classname="cfn-teardown.343434343434.eu-west-1" time="0.000">
+      <skipped message="Stack was not deleted as the run stopped. Status: CREATE_COMPLETE"></skipped>
+    </testcase>
+    <testcase name="qa-app" classname="cfn-teardown.us-east-1" time="150.000"></testcase>
+  </testsuite>
+</testsuites>`
+
+	got, err := testReport().JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("unexpected junit report\nexpected:\n%v\ngot:\n%s", expected, got)
+	}
+}
+
+func TestParseReportFormats(t *testing.T) {
+	formats, err := ParseReportFormats("")
+	if err != nil || len(formats) != 0 {
+		t.Errorf("expected no report formats by default, got %v %v", formats, err)
+	}
+
+	formats, err = ParseReportFormats(" Markdown, junit ,")
+	if err != nil || strings.Join(formats, ",") != "markdown,junit" {
+		t.Errorf("expected markdown and junit formats, got %v %v", formats, err)
+	}
+
+	if _, err = ParseReportFormats("markdown,html"); err == nil {
+		t.Error("expected html format to be rejected")
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	dir := t.TempDir()
+	if err := WriteReports(testReport(), nil, dir); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected no reports without formats, got %v files", len(files))
+	}
+
+	if err := WriteReports(testReport(), []string{"markdown", "json", "junit"}, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range REPORT_FORMATS {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("expected report %v to be written: %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// ROUTE53_CHANGE_BATCH_LIMIT is the number of record set changes sent in a single ChangeResourceRecordSets request.
+// Route53 accepts up to 1000 changes per request but smaller batches keep the request size well within limits.
+const ROUTE53_CHANGE_BATCH_LIMIT = 100
+
+// Route53Manager exposes methods to interact with AWS Route53 service via SDK.
+type Route53Manager struct {
+	TargetAccountId string
+	NukeRoleARN     string
+	AWSProfile      string
+	AWSRegion       string
+	EndpointURL     *string
+}
+
+// EmptyHostedZone deletes all record sets from a hosted zone except the SOA and NS records of the zone apex
+// which are managed by Route53 itself. Returns the list of deleted records in 'NAME TYPE' format for audit.
+func (rm Route53Manager) EmptyHostedZone(ctx context.Context, hostedZoneId string) ([]string, error) {
+	deletedRecords := []string{}
+
+	svc, err := rm.Session(ctx)
+	if err != nil {
+		return deletedRecords, err
+	}
+
+	Logger.Info("Deleting records from hosted zone", "hosted_zone", hostedZoneId)
+
+	zone, err := svc.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(hostedZoneId)})
+	if err != nil {
+		return deletedRecords, fmt.Errorf("Error describing hosted zone '%v': %v", hostedZoneId, err)
+	}
+	apex := aws.ToString(zone.HostedZone.Name)
+
+	records := []types.ResourceRecordSet{}
+	paginator := route53.NewListResourceRecordSetsPaginator(svc, &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(hostedZoneId)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deletedRecords, fmt.Errorf("Error listing records from hosted zone '%v': %v", hostedZoneId, err)
+		}
+		for _, record := range page.ResourceRecordSets {
+			// default records can't be deleted and are removed along with the zone
+			if aws.ToString(record.Name) == apex && (record.Type == types.RRTypeSoa || record.Type == types.RRTypeNs) {
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+
+	for start := 0; start < len(records); start += ROUTE53_CHANGE_BATCH_LIMIT {
+		end := start + ROUTE53_CHANGE_BATCH_LIMIT
+		if end > len(records) {
+			end = len(records)
+		}
+
+		changes := []types.Change{}
+		for i := range records[start:end] {
+			changes = append(changes, types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &records[start+i]})
+		}
+
+		_, err := svc.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(hostedZoneId),
+			ChangeBatch: &types.ChangeBatch{
+				Comment: aws.String("Deleted by cfn-teardown before deleting the hosted zone"),
+				Changes: changes,
+			},
+		})
+		if err != nil {
+			return deletedRecords, fmt.Errorf("Unable to delete records from hosted zone '%v': %v", hostedZoneId, err)
+		}
+
+		for _, record := range records[start:end] {
+			deletedRecords = append(deletedRecords, fmt.Sprintf("%v %v", aws.ToString(record.Name), record.Type))
+		}
+	}
+
+	Logger.Info("Hosted zone emptied successfully", "hosted_zone", hostedZoneId, "records_deleted", len(deletedRecords))
+
+	return deletedRecords, nil
+}
+
+// Session returns the shared aws Route53 client.
+// By default, it uses given aws profile or the default credential chain but it also provides option to assume a different role.
+// It also has validation for target account id to ensure we are deleting in the correct aws account.
+func (rm Route53Manager) Session(ctx context.Context) (*route53.Client, error) {
+	if err := validateTargetAccount(ctx, rm.AWSProfile, rm.AWSRegion, rm.EndpointURL, rm.TargetAccountId, "Route53"); err != nil {
+		return nil, err
+	}
+	cfg, err := NewAWSConfig(rm.AWSProfile, rm.AWSRegion, rm.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("route53", rm.AWSProfile, cfg, rm.NukeRoleARN, route53.NewFromConfig), nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeRecord struct {
+	Name string
+	Type string
+}
+
+// fakeHostedZone serves Route53 rest api requests of a single hosted zone. Records are listed in pages of 60.
+type fakeHostedZone struct {
+	apex      string
+	records   []fakeRecord
+	failBatch int // ChangeResourceRecordSets request failing with invalid input, counted from 1
+
+	mu      sync.Mutex
+	batches [][]fakeRecord // records deleted per ChangeResourceRecordSets request
+}
+
+func (f *fakeHostedZone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/hostedzone/Z0123456789"):
+		fmt.Fprintf(w, `<GetHostedZoneResponse><HostedZone><Id>/hostedzone/Z0123456789</Id><Name>%v</Name><CallerReference>qa</CallerReference></HostedZone></GetHostedZoneResponse>`, f.apex)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/rrset"):
+		start := 0
+		if name := r.URL.Query().Get("name"); name != "" {
+			for i, record := range f.records {
+				if record.Name == name && record.Type == r.URL.Query().Get("type") {
+					start = i
+				}
+			}
+		}
+		end := start + 60
+		if end > len(f.records) {
+			end = len(f.records)
+		}
+		io.WriteString(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>`)
+		for _, record := range f.records[start:end] {
+			fmt.Fprintf(w, `<ResourceRecordSet><Name>%v</Name><Type>%v</Type><TTL>300</TTL><ResourceRecords><ResourceRecord><Value>record</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>`, record.Name, record.Type)
+		}
+		io.WriteString(w, `</ResourceRecordSets><MaxItems>60</MaxItems>`)
+		if end < len(f.records) {
+			fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextRecordName>%v</NextRecordName><NextRecordType>%v</NextRecordType>`, f.records[end].Name, f.records[end].Type)
+		} else {
+			io.WriteString(w, `<IsTruncated>false</IsTruncated>`)
+		}
+		io.WriteString(w, `</ListResourceRecordSetsResponse>`)
+	case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/rrset"):
+		var in struct {
+			Changes []struct {
+				Action string `xml:"Action"`
+				Name   string `xml:"ResourceRecordSet>Name"`
+				Type   string `xml:"ResourceRecordSet>Type"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(f.batches)+1 == f.failBatch {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidInput</Code><Message>record changed meanwhile</Message></Error></ErrorResponse>`)
+			return
+		}
+		batch := []fakeRecord{}
+		for _, c := range in.Changes {
+			if c.Action != "DELETE" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			batch = append(batch, fakeRecord{Name: c.Name, Type: c.Type})
+		}
+		f.batches = append(f.batches, batch)
+		io.WriteString(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2021-02-07T03:30:54Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newFakeHostedZone has the default apex records, a delegation of a subdomain and the given number of A records
+func newFakeHostedZone(hosts int) *fakeHostedZone {
+	f := &fakeHostedZone{
+		apex: "example.com.",
+		records: []fakeRecord{
+			{Name: "example.com.", Type: "NS"},
+			{Name: "example.com.", Type: "SOA"},
+			{Name: "dev.example.com.", Type: "NS"},
+		},
+	}
+	for i := 0; i < hosts; i++ {
+		f.records = append(f.records, fakeRecord{Name: fmt.Sprintf("host-%03d.example.com.", i), Type: "A"})
+	}
+	return f
+}
+
+func TestEmptyHostedZoneSkipsApexRecords(t *testing.T) {
+	fake := newFakeHostedZone(2)
+	rm := Route53Manager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	deleted, err := rm.EmptyHostedZone(context.Background(), "Z0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"dev.example.com. NS", "host-000.example.com. A", "host-001.example.com. A"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected deleted records %v, got %v", expected, deleted)
+	}
+	if len(fake.batches) != 1 {
+		t.Errorf("expected a single change batch, got %v", len(fake.batches))
+	}
+}
+
+func TestEmptyHostedZoneDeletesInBatches(t *testing.T) {
+	fake := newFakeHostedZone(150)
+	rm := Route53Manager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	deleted, err := rm.EmptyHostedZone(context.Background(), "Z0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 151 {
+		t.Fatalf("expected 151 deleted records, got %v", len(deleted))
+	}
+	if deleted[0] != "dev.example.com. NS" || deleted[150] != "host-149.example.com. A" {
+		t.Errorf("unexpected deleted records %v ... %v", deleted[0], deleted[150])
+	}
+	if len(fake.batches) != 2 || len(fake.batches[0]) != ROUTE53_CHANGE_BATCH_LIMIT || len(fake.batches[1]) != 51 {
+		sizes := []int{}
+		for _, b := range fake.batches {
+			sizes = append(sizes, len(b))
+		}
+		t.Errorf("expected batches of 100 and 51 records, got %v", sizes)
+	}
+}
+
+func TestEmptyHostedZoneReturnsRecordsDeletedBeforeFailure(t *testing.T) {
+	fake := newFakeHostedZone(150)
+	fake.failBatch = 2
+	rm := Route53Manager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	deleted, err := rm.EmptyHostedZone(context.Background(), "Z0123456789")
+	if err == nil || !strings.Contains(err.Error(), "record changed meanwhile") {
+		t.Fatalf("expected the failed change batch to be reported, got %v", err)
+	}
+	if len(deleted) != ROUTE53_CHANGE_BATCH_LIMIT || deleted[99] != "host-098.example.com. A" {
+		t.Errorf("expected the 100 records of the first batch, got %v", len(deleted))
+	}
+}
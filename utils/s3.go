@@ -18,14 +18,12 @@ limitations under the License.
 package utils
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Manager exposes methods to interact with AWS S3 service via SDK.
@@ -37,90 +35,81 @@ type S3Manager struct {
 	EndpointURL     *string
 }
 
-// EmptyBucket deletes all objects from a particular S3 bucket.
-func (sm S3Manager) EmptyBucket(bucketName string) error {
-	svc, err := sm.Session()
+// EmptyBucket deletes all objects from a particular S3 bucket including all versions and delete markers of versioned buckets,
+// since S3 refuses to delete a bucket as long as any version is left. Objects of unversioned buckets are listed with the 'null' version.
+func (sm S3Manager) EmptyBucket(ctx context.Context, bucketName string) error {
+	svc, err := sm.Session(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Emptying bucket '%v'...\n", bucketName)
+	Logger.Info("Emptying bucket", "bucket", bucketName)
 
-	// Setup BatchDeleteIterator to iterate through a list of objects
-	iterator := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{Bucket: aws.String(bucketName)})
-	err = s3manager.NewBatchDeleteWithClient(svc).Delete(aws.BackgroundContext(), iterator)
-	if err != nil {
-		fmt.Printf("Unable to delete objects from bucket '%v': %v\n", bucketName, err)
-		return err
+	// each page has at most 1000 versions and delete markers which is also the limit of a single DeleteObjects request
+	paginator := s3.NewListObjectVersionsPaginator(svc, &s3.ListObjectVersionsInput{Bucket: aws.String(bucketName)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			Logger.Error("Unable to list object versions from bucket", "bucket", bucketName, LOG_ERROR, err)
+			return err
+		}
+
+		objects := []types.ObjectIdentifier{}
+		for _, version := range page.Versions {
+			objects = append(objects, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			continue
+		}
+
+		resp, err := svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			Logger.Error("Unable to delete objects from bucket", "bucket", bucketName, LOG_ERROR, err)
+			return err
+		}
+		// objects are deleted individually, so the request succeeds even if some of them could not be deleted
+		if len(resp.Errors) > 0 {
+			e := resp.Errors[0]
+			return fmt.Errorf("Unable to delete %v objects from bucket '%v' e.g. '%v': %v", len(resp.Errors), bucketName, aws.ToString(e.Key), aws.ToString(e.Message))
+		}
 	}
 
 	// check if the bucket is empty
-	resp, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+	resp, err := svc.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
 		Bucket: &bucketName,
 	})
 	if err != nil {
-		return fmt.Errorf("Error listing objects from bucket '%v': %v", bucketName, err)
+		return fmt.Errorf("Error listing object versions from bucket '%v': %v", bucketName, err)
 	}
 
-	if len(resp.Contents) != 0 {
-		return fmt.Errorf("Failed to empty bucket. Number of items left: %v", len(resp.Contents))
+	if left := len(resp.Versions) + len(resp.DeleteMarkers); left != 0 {
+		return fmt.Errorf("Failed to empty bucket. Number of items left: %v", left)
 	}
 
-	fmt.Printf("Bucket '%v' emptied successfully\n", bucketName)
+	Logger.Info("Bucket emptied successfully", "bucket", bucketName)
 
 	return nil
 }
 
-// Session creates a new aws S3 session.
-// By default, it uses given aws profile and region but it also provides option to assume a different role.
+// Session returns the shared aws S3 client.
+// By default, it uses given aws profile or the default credential chain but it also provides option to assume a different role.
 // It also has validation for target account id to ensure we are deleting in the correct aws account.
-func (sm S3Manager) Session() (*s3.S3, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-			Region: aws.String(sm.AWSRegion),
-			// localstack endpoint URL is passed during integration tests, otherwise it is nil
-			Endpoint: sm.EndpointURL,
-		},
-		SharedConfigState: session.SharedConfigEnable,
-		Profile:           sm.AWSProfile,
-	}))
-
-	// validation for target account id
-	if sm.TargetAccountId != "" {
-		aID, err := sm.AWSSessionAccountID(sess)
-		if err != nil {
-			fmt.Printf("Error requesting AWS caller identity: %v", err.Error())
-			return nil, err
-		}
-
-		if aID != sm.TargetAccountId {
-			return nil, fmt.Errorf(
-				"[S3] Target account id (%v) did not match with account id (%v) in the current AWS session",
-				sm.TargetAccountId,
-				aID,
-			)
-		}
+func (sm S3Manager) Session(ctx context.Context) (*s3.Client, error) {
+	if err := validateTargetAccount(ctx, sm.AWSProfile, sm.AWSRegion, sm.EndpointURL, sm.TargetAccountId, "S3"); err != nil {
+		return nil, err
 	}
-
-	if sm.NukeRoleARN == "" {
-		// this means, we are using given aws profile
-		return s3.New(sess), nil
-	}
-
-	// Create the credentials from AssumeRoleProvider if nuke role arn is provided
-	creds := stscreds.NewCredentials(sess, sm.NukeRoleARN)
-	// Create service client value configured for credentials from assumed role
-	return s3.New(sess, &aws.Config{Credentials: creds, MaxRetries: &AWS_SDK_MAX_RETRY}), nil
-}
-
-// AWSSessionAccountID fetches account id from current aws session
-func (sm S3Manager) AWSSessionAccountID(sess *session.Session) (acID string, err error) {
-	svc := sts.New(sess)
-	result, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	cfg, err := NewAWSConfig(sm.AWSProfile, sm.AWSRegion, sm.EndpointURL)
 	if err != nil {
-		fmt.Printf("Error requesting AWS caller identity: %v", err.Error())
-		return
+		return nil, err
 	}
-	acID = *result.Account
-	return
+	return sharedConfigClient("s3", sm.AWSProfile, cfg, sm.NukeRoleARN, s3.NewFromConfig, func(o *s3.Options) {
+		// localstack serves buckets on the path of its endpoint instead of bucket subdomains
+		o.UsePathStyle = sm.EndpointURL != nil
+	}), nil
 }
@@ -0,0 +1,78 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVersionedBucket serves a versioned bucket with two versions of an object and a delete marker of another one
+type fakeVersionedBucket struct {
+	mu      sync.Mutex
+	deleted []string // 'key@version' of deleted versions and delete markers
+}
+
+func (f *fakeVersionedBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/xml")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Has("versions"):
+		io.WriteString(w, `<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>qa-assets</Name><IsTruncated>false</IsTruncated>`)
+		if len(f.deleted) == 0 {
+			io.WriteString(w, `<Version><Key>logo.png</Key><VersionId>v2</VersionId><IsLatest>true</IsLatest></Version>`+
+				`<Version><Key>logo.png</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest></Version>`+
+				`<DeleteMarker><Key>old.css</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest></DeleteMarker>`)
+		}
+		io.WriteString(w, `</ListVersionsResult>`)
+	case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		var req struct {
+			Objects []struct {
+				Key       string `xml:"Key"`
+				VersionId string `xml:"VersionId"`
+			} `xml:"Object"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		xml.Unmarshal(body, &req)
+		for _, o := range req.Objects {
+			f.deleted = append(f.deleted, o.Key+"@"+o.VersionId)
+		}
+		io.WriteString(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></DeleteResult>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `<Error><Code>InvalidRequest</Code><Message>unexpected request `+r.Method+` `+r.URL.String()+`</Message></Error>`)
+	}
+}
+
+func TestEmptyBucketDeletesVersionsAndDeleteMarkers(t *testing.T) {
+	fake := &fakeVersionedBucket{}
+	sm := S3Manager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	if err := sm.EmptyBucket(context.Background(), "qa-assets"); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := strings.Join(fake.deleted, ","); deleted != "logo.png@v2,logo.png@v1,old.css@v3" {
+		t.Errorf("expected all versions and delete markers to be deleted, got %v", deleted)
+	}
+}
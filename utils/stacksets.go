@@ -0,0 +1,204 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// STACKSET_STACK_PREFIX prefixes names of stacks created by StackSets i.e. 'StackSet-<stack set name>-<uuid>'.
+const STACKSET_STACK_PREFIX = "StackSet-"
+
+// StackSetManager exposes methods to interact with CloudFormation StackSets of the administrator account via SDK.
+// StackSets live in the administrator account, so the target account id is not validated here.
+type StackSetManager struct {
+	AdminRoleARN string
+	AWSProfile   string
+	AWSRegion    string // region where the StackSets are created
+	CallAs       string // 'SELF' or 'DELEGATED_ADMIN' for StackSets of AWS Organizations administered by a member account
+	EndpointURL  *string
+}
+
+// ErrStackSetOperationInProgress is returned when a stack instance can't be removed yet because another operation of the
+// StackSet is running. StackSets run one operation at a time unless managed execution is turned on for them.
+var ErrStackSetOperationInProgress = errors.New("another operation of the StackSet is in progress")
+
+// NewStackSetManager creates manager for StackSets of the administrator account. StackSets are looked up in STACKSET_REGION or AWS_REGION.
+func NewStackSetManager(config models.Config) (StackSetManager, error) {
+	if config.StackSetCallAs != "" && config.StackSetCallAs != string(types.CallAsSelf) && config.StackSetCallAs != string(types.CallAsDelegatedAdmin) {
+		return StackSetManager{}, fmt.Errorf("Invalid StackSet call as '%v'. Supported values: %v, %v", config.StackSetCallAs, types.CallAsSelf, types.CallAsDelegatedAdmin)
+	}
+	if config.DeleteEmptyStackSets && !config.DeleteStackSetInstances {
+		return StackSetManager{}, fmt.Errorf("DELETE_EMPTY_STACKSETS requires DELETE_STACKSET_INSTANCES to be true")
+	}
+	region := config.StackSetRegion
+	if region == "" {
+		region = config.AWSRegion
+	}
+	return StackSetManager{AdminRoleARN: config.StackSetAdminRoleARN, AWSProfile: config.AWSProfile, AWSRegion: region, CallAs: config.StackSetCallAs, EndpointURL: config.EndpointURL}, nil
+}
+
+// StackSetName returns name of the StackSet which created the stack or empty if the stack is not managed by a StackSet.
+func StackSetName(stackName string) string {
+	if !strings.HasPrefix(stackName, STACKSET_STACK_PREFIX) {
+		return ""
+	}
+	// stack instance name ends with a uuid e.g. StackSet-qa-guardrails-5f2b6c8e-3d4a-4b1c-9e7f-0a1b2c3d4e5f
+	name := strings.TrimPrefix(stackName, STACKSET_STACK_PREFIX)
+	if len(name) < 38 || name[len(name)-37] != '-' || strings.Count(name[len(name)-36:], "-") != 4 {
+		return ""
+	}
+	return name[:len(name)-37]
+}
+
+// DeleteStackInstance removes the stack instance of an account and region from the StackSet which also deletes its stack.
+// Returns id of the StackSet operation. Instances of StackSets deployed to organizational units can't be removed for a
+// single account, so they are reported as errors. ErrStackSetOperationInProgress is returned if the StackSet is busy with another operation.
+func (sm StackSetManager) DeleteStackInstance(ctx context.Context, stackSetName, accountID, region string) (string, error) {
+	Logger.Info("Submitting delete request for stack instance", "stack_set", stackSetName, "account_id", accountID, "region", region)
+	cfn, err := sm.Session(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := cfn.ListStackInstances(ctx, &cloudformation.ListStackInstancesInput{
+		StackSetName:         &stackSetName,
+		StackInstanceAccount: &accountID,
+		StackInstanceRegion:  &region,
+		CallAs:               sm.callAs(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Summaries) == 0 {
+		return "", fmt.Errorf("No stack instance of StackSet '%v' found in account '%v' and region '%v'", stackSetName, accountID, region)
+	}
+	if ou := aws.ToString(resp.Summaries[0].OrganizationalUnitId); ou != "" {
+		return "", fmt.Errorf("Stack instance of StackSet '%v' is deployed to organizational unit '%v' and can't be removed for account '%v' alone", stackSetName, ou, accountID)
+	}
+
+	out, err := cfn.DeleteStackInstances(ctx, &cloudformation.DeleteStackInstancesInput{
+		StackSetName: &stackSetName,
+		Accounts:     []string{accountID},
+		Regions:      []string{region},
+		RetainStacks: aws.Bool(false),
+		CallAs:       sm.callAs(),
+	})
+	var inProgress *types.OperationInProgressException
+	if errors.As(err, &inProgress) {
+		return "", fmt.Errorf("Unable to remove stack instance of StackSet '%v': %w", stackSetName, ErrStackSetOperationInProgress)
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.OperationId), nil
+}
+
+// OperationStatus returns status of a StackSet operation e.g. RUNNING, SUCCEEDED or FAILED.
+// For unsuccessful operations, the status reason of the stack instance in the given account and region is returned as well.
+func (sm StackSetManager) OperationStatus(ctx context.Context, stackSetName, operationID, accountID, region string) (status types.StackSetOperationStatus, reason string, err error) {
+	cfn, err := sm.Session(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := cfn.DescribeStackSetOperation(ctx, &cloudformation.DescribeStackSetOperationInput{
+		StackSetName: &stackSetName,
+		OperationId:  &operationID,
+		CallAs:       sm.callAs(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	status = resp.StackSetOperation.Status
+	if status != types.StackSetOperationStatusFailed && status != types.StackSetOperationStatusStopped {
+		return status, "", nil
+	}
+
+	reason = fmt.Sprintf("StackSet operation '%v' of StackSet '%v' %v", operationID, stackSetName, strings.ToLower(string(status)))
+	paginator := cloudformation.NewListStackSetOperationResultsPaginator(cfn, &cloudformation.ListStackSetOperationResultsInput{StackSetName: &stackSetName, OperationId: &operationID, CallAs: sm.callAs()})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			Logger.Warn("Unable to list results of StackSet operation", "stack_set", stackSetName, "operation_id", operationID, LOG_ERROR, err)
+			break
+		}
+		for _, r := range page.Summaries {
+			if aws.ToString(r.Account) == accountID && aws.ToString(r.Region) == region && aws.ToString(r.StatusReason) != "" {
+				return status, reason + ": " + aws.ToString(r.StatusReason), nil
+			}
+		}
+	}
+	return status, reason, nil
+}
+
+// OperationPending returns true if the StackSet operation has not finished yet.
+func OperationPending(status types.StackSetOperationStatus) bool {
+	return status == types.StackSetOperationStatusRunning || status == types.StackSetOperationStatusQueued || status == types.StackSetOperationStatusStopping
+}
+
+// DeleteStackSetIfEmpty deletes the StackSet once all of its stack instances have been removed.
+// Returns true if the StackSet was deleted.
+func (sm StackSetManager) DeleteStackSetIfEmpty(ctx context.Context, stackSetName string) (bool, error) {
+	cfn, err := sm.Session(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := cfn.ListStackInstances(ctx, &cloudformation.ListStackInstancesInput{StackSetName: &stackSetName, CallAs: sm.callAs(), MaxResults: aws.Int32(1)})
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Summaries) > 0 {
+		return false, nil
+	}
+
+	Logger.Info("Deleting empty StackSet", "stack_set", stackSetName)
+	_, err = cfn.DeleteStackSet(ctx, &cloudformation.DeleteStackSetInput{StackSetName: &stackSetName, CallAs: sm.callAs()})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// callAs defaults to SELF i.e. StackSets are administered by the account of the session.
+func (sm StackSetManager) callAs() types.CallAs {
+	if sm.CallAs == "" {
+		return types.CallAsSelf
+	}
+	return types.CallAs(sm.CallAs)
+}
+
+// Session returns the shared aws cloudformation client of the administrator account.
+// By default it uses given aws profile or the default credential chain but it also provides option to assume a role of the administrator account.
+func (sm StackSetManager) Session(ctx context.Context) (*cloudformation.Client, error) {
+	cfg, err := NewAWSConfig(sm.AWSProfile, sm.AWSRegion, sm.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	return sharedConfigClient("cloudformation", sm.AWSProfile, cfg, sm.AdminRoleARN, cloudformation.NewFromConfig), nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// fakeStackSets is a CloudFormation endpoint which runs a single StackSet operation at a time like CloudFormation does
+type fakeStackSets struct {
+	mu        sync.Mutex
+	running   bool
+	deletes   []string // accounts of accepted DeleteStackInstances requests
+	conflicts int
+}
+
+func (f *fakeStackSets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch form.Get("Action") {
+	case "ListStackInstances":
+		io.WriteString(w, `<ListStackInstancesResponse><ListStackInstancesResult><Summaries><member>`+
+			`<StackSetId>guardrails:1</StackSetId><Account>`+form.Get("StackInstanceAccount")+`</Account><Region>`+form.Get("StackInstanceRegion")+`</Region>`+
+			`</member></Summaries></ListStackInstancesResult></ListStackInstancesResponse>`)
+	case "DeleteStackInstances":
+		if f.running {
+			f.conflicts++
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>OperationInProgressException</Code>`+
+				`<Message>Another Operation on StackSet guardrails is in progress</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+			return
+		}
+		f.running = true
+		f.deletes = append(f.deletes, form.Get("Accounts.member.1"))
+		io.WriteString(w, `<DeleteStackInstancesResponse><DeleteStackInstancesResult><OperationId>op-1</OperationId></DeleteStackInstancesResult></DeleteStackInstancesResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidAction</Code><Message>unexpected action</Message></Error></ErrorResponse>`)
+	}
+}
+
+func TestDeleteStackInstanceReportsOperationInProgress(t *testing.T) {
+	fake := &fakeStackSets{}
+	sm := StackSetManager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	opID, err := sm.DeleteStackInstance(context.Background(), "guardrails", "111111111111", "us-east-1")
+	if err != nil || opID != "op-1" {
+		t.Fatalf("expected first stack instance to be removed, got %v %v", opID, err)
+	}
+
+	_, err = sm.DeleteStackInstance(context.Background(), "guardrails", "222222222222", "us-east-1")
+	if !errors.Is(err, ErrStackSetOperationInProgress) {
+		t.Fatalf("expected operation in progress error, got %v", err)
+	}
+	if len(fake.deletes) != 1 || fake.conflicts != 1 {
+		t.Errorf("expected one accepted and one rejected request, got %v accepted and %v rejected", len(fake.deletes), fake.conflicts)
+	}
+}
+
+func TestRequestStackDeletionQueuesStackOfBusyStackSet(t *testing.T) {
+	fake := &fakeStackSets{}
+	sm := StackSetManager{AWSRegion: "us-east-1", EndpointURL: fakeAWSEndpoint(t, fake.ServeHTTP)}
+
+	// instances of the same StackSet in two accounts are deleted in the same wave
+	first := models.StackDetails{StackName: "StackSet-guardrails-5f2b6c8e-3d4a-4b1c-9e7f-0a1b2c3d4e5f", Region: "us-east-1", AccountID: "111111111111", StackSetName: "guardrails"}
+	second := first
+	second.AccountID = "222222222222"
+
+	first, err := requestStackDeletion(context.Background(), first, TargetManagers{}, sm, "")
+	if err != nil || first.StackSetOperationId != "op-1" {
+		t.Fatalf("expected first stack instance to be removed, got %v %v", first.StackSetOperationId, err)
+	}
+
+	queued, err := requestStackDeletion(context.Background(), second, TargetManagers{}, sm, "")
+	if !errors.Is(err, ErrStackSetOperationInProgress) {
+		t.Fatalf("expected second stack to be queued, got %v", err)
+	}
+	if queued.StackSetOperationId != "" {
+		t.Errorf("expected queued stack to have no operation, got %v", queued.StackSetOperationId)
+	}
+
+	// once the operation has finished, the queued stack instance is removed
+	fake.running = false
+	second, err = requestStackDeletion(context.Background(), queued, TargetManagers{}, sm, "")
+	if err != nil || second.StackSetOperationId != "op-1" {
+		t.Fatalf("expected queued stack instance to be removed, got %v %v", second.StackSetOperationId, err)
+	}
+	if len(fake.deletes) != 2 || fake.deletes[1] != "222222222222" {
+		t.Errorf("expected stack instances of both accounts to be removed, got %v", fake.deletes)
+	}
+}
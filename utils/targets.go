@@ -0,0 +1,185 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// Target is an account and region where matching stacks are deleted.
+type Target struct {
+	AccountID string // only set for accounts listed in the accounts manifest
+	RoleARN   string
+	Region    string
+}
+
+// TargetManagers are the managers of a single target.
+type TargetManagers struct {
+	CFN CFNManager
+	S3  S3Manager
+	ECR ECRManager
+	R53 Route53Manager
+	IAM IAMManager
+}
+
+// Key identifies the target e.g. 'us-east-1' or '121212121212/us-east-1' for accounts listed in the manifest.
+func (t Target) Key() string {
+	if t.AccountID == "" {
+		return t.Region
+	}
+	return t.AccountID + "/" + t.Region
+}
+
+// StackKey identifies a stack of the target in the dependency tree.
+func (t Target) StackKey(stackName string) string {
+	return t.Key() + "/" + stackName
+}
+
+// StackKey identifies a stack in the dependency tree as stacks with the same name can exist in multiple regions and accounts e.g. 'us-east-1/qa-vpc'.
+func StackKey(stack models.StackDetails) string {
+	return StackTarget(stack).StackKey(stack.StackName)
+}
+
+// StackTarget returns the target where the stack exists.
+func StackTarget(stack models.StackDetails) Target {
+	return Target{AccountID: stack.AccountID, Region: stack.Region}
+}
+
+// stackNameFromKey returns the stack name part of the stack key.
+func stackNameFromKey(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// LoadAccountsManifest reads the accounts manifest from a yaml or json file.
+func LoadAccountsManifest(path string) (models.AccountsManifest, error) {
+	manifest := models.AccountsManifest{}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("Unable to read accounts manifest: %v", err)
+	}
+	if err = yaml.UnmarshalStrict(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("Unable to parse accounts manifest '%v': %v", path, err)
+	}
+	if len(manifest.Accounts) == 0 {
+		return manifest, fmt.Errorf("No accounts found in accounts manifest '%v'", path)
+	}
+
+	seen := map[string]struct{}{}
+	for i, account := range manifest.Accounts {
+		if account.AccountID == "" {
+			return manifest, fmt.Errorf("Missing 'account_id' of account #%v in accounts manifest '%v'", i+1, path)
+		}
+		if _, ok := seen[account.AccountID]; ok {
+			return manifest, fmt.Errorf("Account '%v' is listed more than once in accounts manifest '%v'", account.AccountID, path)
+		}
+		seen[account.AccountID] = struct{}{}
+	}
+	return manifest, nil
+}
+
+// ParseTargets returns targets of the run. Every account of the manifest is a target in each of its regions,
+// without a manifest the account of the aws profile or ROLE_ARN is the target in each of the given regions.
+func ParseTargets(config models.Config, regions []string) ([]Target, error) {
+	targets := []Target{}
+	if config.AccountsManifest == "" {
+		for _, region := range regions {
+			targets = append(targets, Target{RoleARN: config.RoleARN, Region: region})
+		}
+		return targets, nil
+	}
+
+	manifest, err := LoadAccountsManifest(config.AccountsManifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range manifest.Accounts {
+		accountRegions := ParseRegions(strings.Join(account.Regions, ","), "")
+		if len(accountRegions) == 0 {
+			accountRegions = regions
+		}
+		if len(accountRegions) == 0 {
+			return nil, fmt.Errorf("No regions for account '%v' in accounts manifest. Set its 'regions' or AWS_REGION", account.AccountID)
+		}
+		for _, region := range accountRegions {
+			targets = append(targets, Target{AccountID: account.AccountID, RoleARN: account.RoleARN, Region: region})
+		}
+	}
+	return targets, nil
+}
+
+// TargetRegions lists distinct regions of the targets.
+func TargetRegions(targets []Target) []string {
+	regions := []string{}
+	for _, t := range targets {
+		regions = append(regions, t.Region)
+	}
+	return ParseRegions(strings.Join(regions, ","), "")
+}
+
+// TargetAccountIDs lists distinct accounts of the targets listed in the accounts manifest.
+func TargetAccountIDs(targets []Target) []string {
+	accounts := []string{}
+	seen := map[string]struct{}{}
+	for _, t := range targets {
+		if _, ok := seen[t.AccountID]; ok || t.AccountID == "" {
+			continue
+		}
+		seen[t.AccountID] = struct{}{}
+		accounts = append(accounts, t.AccountID)
+	}
+	return accounts
+}
+
+// NewTargetManagers creates managers for the target.
+// TARGET_ACCOUNT_ID validates the aws profile in the managers, accounts of the manifest are validated by ValidateTarget instead
+// as their roles are assumed from a different account. Permissions of the target are checked in its own account either way.
+func NewTargetManagers(config models.Config, target Target) TargetManagers {
+	accountID, stacksAccountID := config.TargetAccountId, config.TargetAccountId
+	if target.AccountID != "" {
+		accountID, stacksAccountID = "", target.AccountID
+	}
+	return TargetManagers{
+		CFN: CFNManager{StackPattern: config.StackPattern, TargetAccountId: accountID, NukeRoleARN: target.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: target.Region, EndpointURL: config.EndpointURL},
+		S3:  S3Manager{TargetAccountId: accountID, NukeRoleARN: target.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: target.Region, EndpointURL: config.EndpointURL},
+		ECR: ECRManager{TargetAccountId: accountID, NukeRoleARN: target.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: target.Region, EndpointURL: config.EndpointURL},
+		R53: Route53Manager{TargetAccountId: accountID, NukeRoleARN: target.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: target.Region, EndpointURL: config.EndpointURL},
+		IAM: IAMManager{TargetAccountId: stacksAccountID, NukeRoleARN: target.RoleARN, AWSProfile: config.AWSProfile, AWSRegion: target.Region, EndpointURL: config.EndpointURL},
+	}
+}
+
+// ValidateTarget makes sure that stacks of an account listed in the manifest are deleted in that account i.e. the role belongs to the account.
+func ValidateTarget(ctx context.Context, target Target, m TargetManagers) error {
+	if target.AccountID == "" {
+		return nil
+	}
+	accountID, err := m.CFN.AccountID(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to find account id of target '%v': %v", target.Key(), err)
+	}
+	if accountID != target.AccountID {
+		return fmt.Errorf("Target account id (%v) did not match with account id (%v) of role '%v'", target.AccountID, accountID, target.RoleARN)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// TEMPLATE_EVENTS lists the notification events which have a template for each backend whose message body is rendered from templates.
+// 'run_status' and 'stack_deleted' are used by Slack bot token mode for the parent message and its thread.
+// Email templates only render the event specific text, which is wrapped by the email layouts with the run summary.
+var TEMPLATE_EVENTS = map[string][]string{
+	"slack": {"plan", "start", "error", "stuck", "success", "progress", "run_status", "stack_deleted"},
+	"teams": {"plan", "start", "error", "stuck", "success", "progress"},
+	"email": {"plan", "start", "error", "stuck", "success", "progress"},
+}
+
+// NotificationContext is the data passed to notification templates.
+type NotificationContext struct {
+	RunID             string
+	Event             string // Start | Error | Stuck | Complete
+	Title             string
+	Message           string // Long message with details about the event
+	StackPattern      string
+	AccountID         string
+	Region            string
+	TotalStackCount   int
+	DeletedStackCount int
+	ActiveStackCount  int
+	StartedAt         string
+	UpdatedAt         string
+	DurationInHours   float64
+	Duration          string                // human readable run time e.g. 1h20m5s
+	FailedStacks      []models.StackDetails // stacks which failed to delete
+	Stack             models.StackDetails   // stack the event is about e.g. deleted stack
+	Progress          ProgressDetails       // only for progress event
+	Plan              PlanDetails           // only for plan event
+}
+
+// NotificationTemplates holds parsed templates for every backend and event.
+type NotificationTemplates struct {
+	templates map[string]*template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"add":   func(a, b int) int { return a + b },
+}
+
+// LoadNotificationTemplates parses built-in templates and overrides them with templates found in the given directory.
+// The directory follows the same layout as the built-in templates i.e. '<backend>/<event>.tmpl' e.g. 'slack/error.tmpl'.
+func LoadNotificationTemplates(dir string) (*NotificationTemplates, error) {
+	nt := &NotificationTemplates{templates: map[string]*template.Template{}}
+	for backend, events := range TEMPLATE_EVENTS {
+		for _, event := range events {
+			name := backend + "/" + event + ".tmpl"
+
+			content, err := defaultTemplates.ReadFile("templates/" + name)
+			if err != nil {
+				return nil, fmt.Errorf("Missing built-in template '%v': %v", name, err)
+			}
+
+			if dir != "" {
+				custom, err := os.ReadFile(filepath.Join(dir, backend, event+".tmpl"))
+				if err == nil {
+					Logger.Info("Using custom notification template", "template", filepath.Join(dir, name))
+					content = custom
+				} else if !os.IsNotExist(err) {
+					return nil, fmt.Errorf("Unable to read template '%v': %v", name, err)
+				}
+			}
+
+			tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse template '%v': %v", name, err)
+			}
+			nt.templates[name] = tmpl
+		}
+	}
+	return nt, nil
+}
+
+// Render executes the template of given backend and event.
+func (nt *NotificationTemplates) Render(backend, event string, ctx NotificationContext) (string, error) {
+	name := backend + "/" + event + ".tmpl"
+	tmpl, ok := nt.templates[name]
+	if !ok {
+		return "", fmt.Errorf("Template '%v' not found", name)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, ctx); err != nil {
+		return "", fmt.Errorf("Unable to render template '%v': %v", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// newNotificationContext prepares template data from the current state of the teardown.
+func newNotificationContext(base NotificationContext, am AlertMessage) NotificationContext {
+	ctx := base
+	ctx.Message = am.Message
+	ctx.TotalStackCount = TOTAL_STACK_COUNT
+	ctx.DeletedStackCount = DELETED_STACK_COUNT
+	ctx.ActiveStackCount = ACTIVE_STACK_COUNT
+	ctx.StartedAt = NUKE_START_TIME
+	ctx.UpdatedAt = NUKE_END_TIME
+	ctx.DurationInHours = NUKE_DURATION_IN_HRS
+	ctx.Duration = (time.Duration(NUKE_DURATION_IN_HRS * float64(time.Hour))).Round(time.Second).String()
+	ctx.Stack = am.Stack
+	ctx.Progress = am.Progress
+	ctx.Plan = am.Plan
+	ctx.FailedStacks = nil
+	if am.FailedStack.StackName != "" {
+		ctx.FailedStacks = []models.StackDetails{am.FailedStack}
+	}
+	return ctx
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2021 Nirdosh Gautam
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package utils provides cli specifics methods for interacting with AWS services
+package utils
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/nirdosh17/cfn-teardown/models"
+)
+
+// TRACING_SERVICE_NAME is the service name of exported spans.
+const TRACING_SERVICE_NAME = "cfn-teardown"
+
+// TRACING_FLUSH_TIMEOUT is the max time spent exporting pending spans before exit.
+const TRACING_FLUSH_TIMEOUT = 10 * time.Second
+
+// Tracer creates spans of the teardown. Spans are dropped unless an exporter is set up by StartRunTrace.
+var Tracer = otel.Tracer("github.com/nirdosh17/cfn-teardown")
+
+// RunTrace is the root span of a teardown run along with the spans of stacks being deleted.
+// A stack span covers the whole deletion lifecycle of the stack i.e. emptying resources, delete requests including retries and waiting for deletion.
+type RunTrace struct {
+	ctx      context.Context
+	root     trace.Span
+	stacks   map[string]trace.Span
+	shutdown func(context.Context) error
+}
+
+// StartRunTrace exports spans to the OTLP/HTTP endpoint e.g. 'http://localhost:4318' and starts the root span of the run.
+// Spans are not exported if the endpoint is empty so that callers don't need to check whether tracing is enabled.
+func StartRunTrace(config models.Config) (*RunTrace, error) {
+	rt := &RunTrace{stacks: map[string]trace.Span{}, shutdown: func(context.Context) error { return nil }}
+
+	if config.OTLPEndpoint != "" {
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(config.OTLPEndpoint))
+		if err != nil {
+			return nil, err
+		}
+		res := resource.NewSchemaless(attribute.String("service.name", TRACING_SERVICE_NAME))
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+		otel.SetTracerProvider(provider)
+		rt.shutdown = provider.Shutdown
+	}
+
+	rt.ctx, rt.root = Tracer.Start(context.Background(), "Teardown", trace.WithAttributes(
+		attribute.String(LOG_RUN_ID, RUN_ID),
+		attribute.String("stack_pattern", config.StackPattern),
+		attribute.String("regions", config.AWSRegions),
+		attribute.Bool("dry_run", config.DryRun != "false"),
+	))
+	return rt, nil
+}
+
+// Context returns context carrying the root span.
+func (rt *RunTrace) Context() context.Context {
+	return rt.ctx
+}
+
+// SetAccountID adds account id to the root span once it is known.
+func (rt *RunTrace) SetAccountID(accountID string) {
+	rt.root.SetAttributes(attribute.String("cloud.account.id", accountID))
+}
+
+// StackStarted starts the span of a stack which is about to be deleted. Returned context carries the stack span.
+func (rt *RunTrace) StackStarted(stack models.StackDetails) context.Context {
+	key := StackKey(stack)
+	span, ok := rt.stacks[key]
+	if !ok {
+		_, span = Tracer.Start(rt.ctx, "DeleteStack", trace.WithAttributes(attribute.String(LOG_STACK, stack.StackName), attribute.String("cloud.region", stack.Region)))
+		rt.stacks[key] = span
+	}
+	return trace.ContextWithSpan(rt.ctx, span)
+}
+
+// StackDeleteRequested records a delete request of the stack including retries.
+func (rt *RunTrace) StackDeleteRequested(stack models.StackDetails) {
+	if span, ok := rt.stacks[StackKey(stack)]; ok {
+		span.AddEvent("DeleteRequested", trace.WithAttributes(
+			attribute.Int(LOG_ATTEMPT, int(stack.DeleteAttempt)),
+			attribute.Int("retained_resources", len(stack.RetainedResources)),
+		))
+	}
+}
+
+// StackDeleted ends the span of a deleted stack.
+func (rt *RunTrace) StackDeleted(stack models.StackDetails) {
+	key := StackKey(stack)
+	span, ok := rt.stacks[key]
+	if !ok {
+		return
+	}
+	span.SetAttributes(attribute.Int(LOG_ATTEMPT, int(stack.DeleteAttempt)), attribute.String(LOG_STATUS, stack.Status))
+	span.End()
+	delete(rt.stacks, key)
+}
+
+// End ends spans of stacks which are still open, the root span and exports pending spans.
+// Stack spans are marked as errors if the stacks failed, the rest are left unset as the run stopped before they were deleted.
+func (rt *RunTrace) End(dt map[string]models.StackDetails, status, message string) {
+	for key, span := range rt.stacks {
+		stack := dt[key]
+		span.SetAttributes(attribute.Int(LOG_ATTEMPT, int(stack.DeleteAttempt)), attribute.String(LOG_STATUS, stack.Status))
+		if stackOutcome(stack) == STACK_FAILED_OUTCOME {
+			span.SetStatus(codes.Error, stack.StackStatusReason)
+		}
+		span.End()
+	}
+	rt.stacks = map[string]trace.Span{}
+
+	rt.root.SetAttributes(
+		attribute.String(LOG_STATUS, status),
+		attribute.Int("total_stack_count", TOTAL_STACK_COUNT),
+		attribute.Int("deleted_stack_count", DELETED_STACK_COUNT),
+	)
+	if status != RUN_SUCCEEDED {
+		rt.root.SetStatus(codes.Error, message)
+	}
+	rt.root.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRACING_FLUSH_TIMEOUT)
+	defer cancel()
+	if err := rt.shutdown(ctx); err != nil {
+		Logger.Error("Unable to export traces", LOG_ERROR, err)
+	}
+}
+
+// endSpan marks the span as error if the operation failed and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}